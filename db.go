@@ -4,14 +4,64 @@
 package dbutil
 
 import (
+	"context"
 	"database/sql"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// TimeLayout is the layout used to render timestamps as text
+var TimeLayout = time.RFC3339
+
+// formatters holds a map[reflect.Type]func(interface{}) string that is
+// replaced, never modified, so lookups by strVal need no lock
+var (
+	formatMu   sync.Mutex
+	formatters atomic.Value
+)
+
+// RegisterFormatter sets the function used to render values of type t as
+// text in CSV, TSV and Table output, in place of the default rendering.
+//
+// A nil fn removes the formatter for t.
+func RegisterFormatter(t reflect.Type, fn func(interface{}) string) {
+	formatMu.Lock()
+	defer formatMu.Unlock()
+	old, _ := formatters.Load().(map[reflect.Type]func(interface{}) string)
+	m := make(map[reflect.Type]func(interface{}) string, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	if fn == nil {
+		delete(m, t)
+	} else {
+		m[t] = fn
+	}
+	formatters.Store(m)
+}
+
+// formatter returns the registered formatter for the type of v, if any
+func formatter(v interface{}) (func(interface{}) string, bool) {
+	m, _ := formatters.Load().(map[reflect.Type]func(interface{}) string)
+	if len(m) == 0 {
+		return nil, false
+	}
+	fn, ok := m[reflect.TypeOf(v)]
+	return fn, ok
+}
+
 func strVal(in interface{}) string {
+	if fn, ok := formatter(in); ok {
+		return fn(in)
+	}
 	switch v := in.(type) {
 	case nil:
 		return ""
@@ -21,6 +71,8 @@ func strVal(in interface{}) string {
 		return string(v)
 	case []uint8:
 		return string(v)
+	case time.Time:
+		return v.Format(TimeLayout)
 	default:
 		return fmt.Sprint(v)
 	}
@@ -39,16 +91,124 @@ func Row(db *sql.DB, dest []interface{}, query string, args ...interface{}) erro
 	return db.QueryRow(query, args...).Scan(dest...)
 }
 
+// Scalar returns the single value result of a query
+func Scalar[T any](db *sql.DB, query string, args ...interface{}) (T, error) {
+	return ScalarContext[T](context.Background(), db, query, args...)
+}
+
+// ScalarContext returns the single value result of a query, subject to ctx
+func ScalarContext[T any](ctx context.Context, db *sql.DB, query string, args ...interface{}) (T, error) {
+	var value T
+	err := db.QueryRowContext(ctx, query, args...).Scan(&value)
+	return value, err
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Column returns the values of a single column query
+func Column[T any](db *sql.DB, query string, args ...interface{}) ([]T, error) {
+	return column[T](db, query, args...)
+}
+
+func column[T any](q queryer, query string, args ...interface{}) ([]T, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := Columns(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) != 1 {
+		return nil, fmt.Errorf("expected 1 column but query returns %d", len(columns))
+	}
+	var list []T
+	for rows.Next() {
+		var value T
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, rows.Err()
+}
+
+// Exists reports whether the query returns any rows
+func Exists(db *sql.DB, query string, args ...interface{}) (bool, error) {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	// close on a new line in case the query ends in a comment
+	return Scalar[bool](db, "select exists("+query+"\n)", args...)
+}
+
+// GetBool returns the single boolean result of a query
+func GetBool(db *sql.DB, query string, args ...interface{}) (bool, error) {
+	return Scalar[bool](db, query, args...)
+}
+
+// GetFloat64 returns the single float result of a query
+func GetFloat64(db *sql.DB, query string, args ...interface{}) (float64, error) {
+	return Scalar[float64](db, query, args...)
+}
+
+// TimeFormats are the layouts tried when parsing a text timestamp,
+// which sqlite stores in several formats
+var TimeFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	time.RFC3339Nano,
+}
+
+// GetTime returns the single timestamp result of a query
+//
+// Text values are parsed using TimeFormats (as UTC when no zone is given)
+// and integers are treated as unix seconds
+func GetTime(db *sql.DB, query string, args ...interface{}) (time.Time, error) {
+	value, err := Scalar[interface{}](db, query, args...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case int64:
+		return time.Unix(v, 0).UTC(), nil
+	case nil:
+		return time.Time{}, fmt.Errorf("timestamp is NULL")
+	}
+	text := strings.TrimSpace(strVal(value))
+	for _, layout := range TimeFormats {
+		if t, err := time.ParseInLocation(layout, text, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp: %q", text)
+}
+
 // Get returns a row results
 func Get(db *sql.DB, query string, args ...interface{}) ([]string, []interface{}, error) {
 	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer rows.Close()
+	columns, err := Columns(rows)
+	if err != nil {
+		return nil, nil, err
+	}
 	if !rows.Next() {
-		return nil, nil, sql.ErrNoRows
+		return nil, nil, noRows(rows)
 	}
-	columns, _ := Columns(rows)
 	buff := make([]interface{}, len(columns))
 	dest := make([]interface{}, len(columns))
 	for k := 0; k < len(dest); k++ {
@@ -63,10 +223,14 @@ func RowStrings(db *sql.DB, query string, args ...interface{}) ([]string, error)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+	columns, err := Columns(rows)
+	if err != nil {
+		return nil, err
+	}
 	if !rows.Next() {
-		return nil, sql.ErrNoRows
+		return nil, noRows(rows)
 	}
-	columns, _ := Columns(rows)
 	dest := make([]interface{}, len(columns))
 
 	// recycle columns slice as values buffer
@@ -76,6 +240,37 @@ func RowStrings(db *sql.DB, query string, args ...interface{}) ([]string, error)
 	return columns, rows.Scan(dest...)
 }
 
+// RowStringsNull returns the row results as a slice of strings,
+// along with a mask that is true for each value that is NULL
+func RowStringsNull(db *sql.DB, query string, args ...interface{}) ([]string, []bool, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	columns, err := Columns(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !rows.Next() {
+		return nil, nil, noRows(rows)
+	}
+	buffer := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for k := 0; k < len(dest); k++ {
+		dest[k] = &buffer[k]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, nil, err
+	}
+	nulls := make([]bool, len(columns))
+	for i, v := range buffer {
+		columns[i] = v.String
+		nulls[i] = !v.Valid
+	}
+	return columns, nulls, nil
+}
+
 // Update runs an update query and returns the count of records updated, if any
 func Update(db *sql.DB, query string, args ...interface{}) (int64, error) {
 	mods, _, err := Exec(db, query, args...)
@@ -89,6 +284,8 @@ func Insert(db *sql.DB, query string, args ...interface{}) (int64, error) {
 }
 
 // InsertMany inserts multiple records as a single transaction
+//
+// If a record fails to insert, the error identifies its index in args
 func InsertMany(db *sql.DB, query string, args ...[]interface{}) error {
 	tx, err := db.Begin()
 	if err != nil {
@@ -100,16 +297,154 @@ func InsertMany(db *sql.DB, query string, args ...[]interface{}) error {
 		return err
 	}
 	defer stmt.Close()
-	for _, arg := range args {
+	for i, arg := range args {
 		if _, err = stmt.Exec(arg...); err != nil {
 			tx.Rollback()
-			return err
+			return fmt.Errorf("row %d %v: %w", i, arg, err)
 		}
 	}
 	tx.Commit()
 	return nil
 }
 
+// Placeholders returns a comma separated list of n query placeholders
+func Placeholders(n int) string {
+	if n < 1 {
+		return ""
+	}
+	return strings.Repeat("?,", n-1) + "?"
+}
+
+// Expand expands each placeholder matched to a slice arg into a placeholder
+// for each element, and flattens the slices into the returned args,
+// e.g. for "where id in (?)".
+//
+// An empty slice leaves an empty list, which sqlite accepts: "in ()"
+// matches no rows and "not in ()" matches every row.
+// Byte slices are treated as single values.
+// A ? within quotes or comments is not a placeholder.
+func Expand(query string, args ...interface{}) (string, []interface{}) {
+	var b strings.Builder
+	flat := make([]interface{}, 0, len(args))
+	s := &sqlScanner{src: query}
+	for {
+		tok, ok := s.next()
+		if !ok {
+			break
+		}
+		if tok.kind != tokenPunct || tok.text != "?" || len(args) == 0 {
+			b.WriteString(tok.text)
+			continue
+		}
+		arg := args[0]
+		args = args[1:]
+		v := reflect.ValueOf(arg)
+		switch {
+		case v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8:
+			flat = append(flat, arg)
+			b.WriteString(tok.text)
+		case v.Len() == 0:
+			// sqlite allows an empty list
+		default:
+			for i := 0; i < v.Len(); i++ {
+				flat = append(flat, v.Index(i).Interface())
+			}
+			b.WriteString(Placeholders(v.Len()))
+		}
+	}
+	return b.String(), append(flat, args...)
+}
+
+// Interpolate returns the query with its placeholders replaced by the args
+// as SQL literals, for logging and debugging.
+//
+// The result is NOT safe to execute, use the query and args instead.
+func Interpolate(query string, args []interface{}) string {
+	var b strings.Builder
+	s := &sqlScanner{src: query}
+	for {
+		tok, ok := s.next()
+		if !ok {
+			break
+		}
+		if tok.kind == tokenPunct && tok.text == "?" && len(args) > 0 {
+			b.WriteString(sqlLiteral(args[0]))
+			args = args[1:]
+			continue
+		}
+		b.WriteString(tok.text)
+	}
+	return b.String()
+}
+
+// QuoteIdent quotes a table or column name for use in a query,
+// escaping embedded quotes per sqlite rules.
+//
+// Use it for names that can't be passed as query args
+func QuoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// ReplaceTableData replaces all rows of a table with the given rows in a single transaction
+//
+// Each row must provide a value for every column of the table
+func ReplaceTableData(db *sql.DB, table string, rows [][]interface{}) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("delete from " + QuoteIdent(table)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if len(rows) > 0 {
+		query := fmt.Sprintf("insert into %s values(%s)", QuoteIdent(table), Placeholders(len(rows[0])))
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		defer stmt.Close()
+		for _, row := range rows {
+			if _, err := stmt.Exec(row...); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// CountDistinct returns the number of distinct values of a column in a table,
+// limited to rows matching the where clause if one is given
+func CountDistinct(db *sql.DB, table, column, where string, args ...interface{}) (int64, error) {
+	query := fmt.Sprintf("select count(distinct %s) from %s", QuoteIdent(column), QuoteIdent(table))
+	if where = strings.TrimSpace(where); where != "" {
+		query += " where " + where
+	}
+	return Scalar[int64](db, query, args...)
+}
+
+// WithTx runs fn in a transaction, committing if it returns nil and
+// rolling back if it returns an error or panics
+func WithTx(db *sql.DB, fn func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 // Exec executes a query and returns the effected records info
 func Exec(db *sql.DB, query string, args ...interface{}) (affected, last int64, err error) {
 	query = strings.TrimSpace(query)
@@ -125,7 +460,18 @@ func Exec(db *sql.DB, query string, args ...interface{}) (affected, last int64,
 	return affected, last, nil
 }
 
+// noRows returns the error that ended the rows, or sql.ErrNoRows if there were none
+func noRows(rows *sql.Rows) error {
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return sql.ErrNoRows
+}
+
 // Columns returns a slice of column names that respects aliases in the query
+//
+// The names are available as soon as the query succeeds, even if it returns no rows.
+// Once the rows have been read through or closed, an error is returned.
 func Columns(row *sql.Rows) ([]string, error) {
 	ctypes, err := row.ColumnTypes()
 	if err != nil {
@@ -138,6 +484,39 @@ func Columns(row *sql.Rows) ([]string, error) {
 	return columns, nil
 }
 
+// ColumnMeta describes a column of query results
+type ColumnMeta struct {
+	Name             string
+	DatabaseTypeName string
+	Nullable         bool // false if the driver does not report nullability
+	ScanType         reflect.Type
+}
+
+// QueryColumns returns the metadata of the columns of the query results
+func QueryColumns(db *sql.DB, query string, args ...interface{}) ([]ColumnMeta, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ctypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	meta := make([]ColumnMeta, len(ctypes))
+	for i, c := range ctypes {
+		nullable, _ := c.Nullable()
+		meta[i] = ColumnMeta{
+			Name:             c.Name(),
+			DatabaseTypeName: c.DatabaseTypeName(),
+			Nullable:         nullable,
+			ScanType:         c.ScanType(),
+		}
+	}
+	return meta, nil
+}
+
 // StreamFunc is a function called for each row by Stream (columns, row number, values).
 //
 // Row numbering starts at 1.
@@ -148,6 +527,7 @@ type Streamer struct {
 	db    *sql.DB
 	query string
 	args  []interface{}
+	limit int
 }
 
 // NewStreamer returns a Streamer
@@ -155,13 +535,141 @@ func NewStreamer(db *sql.DB, query string, args ...interface{}) *Streamer {
 	return &Streamer{db: db, query: query, args: args}
 }
 
+// Limit stops streaming after n rows, regardless of the query (no limit if n < 1)
+func (s *Streamer) Limit(n int) *Streamer {
+	s.limit = n
+	return s
+}
+
 // Stream sends each row the query results to a StreamFunc
 func (s *Streamer) Stream(fn StreamFunc) error {
-	return stream(s.db, fn, s.query, s.args...)
+	return streamN(s.db, fn, s.limit, s.query, s.args...)
+}
+
+// Chan streams a copy of each row of the query results to the data channel,
+// which is closed when the stream ends. The error channel then receives the
+// result of the stream, which is ctx.Err() if ctx was done first.
+func (s *Streamer) Chan(ctx context.Context) (<-chan []interface{}, <-chan error) {
+	data := make(chan []interface{})
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(data)
+		fn := func(columns []string, count int, buffer []interface{}) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			// the buffer is reused for each row
+			row := make([]interface{}, len(buffer))
+			copy(row, buffer)
+			select {
+			case data <- row:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		errc <- s.Stream(fn)
+	}()
+	return data, errc
+}
+
+// ReduceFunc folds a row of query results into an accumulated value
+type ReduceFunc func(acc interface{}, columns []string, values []interface{}) (interface{}, error)
+
+// Reduce threads an accumulated value, starting with init, through each row of the query results
+func (s *Streamer) Reduce(init interface{}, fn ReduceFunc) (interface{}, error) {
+	acc := init
+	err := s.Stream(func(columns []string, count int, values []interface{}) error {
+		var err error
+		acc, err = fn(acc, columns, values)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+// Rows iterates over query results, as an alternative to a StreamFunc.
+// Close must be called when done, whether or not all rows were read.
+type Rows struct {
+	rows    *sql.Rows
+	columns []string
+	buffer  []interface{}
+	dest    []interface{}
+	limit   int
+	count   int
+}
+
+// Iter runs the query and returns an iterator over the results
+func (s *Streamer) Iter() (*Rows, error) {
+	rows, err := s.db.Query(s.query, s.args...)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := Columns(rows)
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	buffer := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for k := 0; k < len(buffer); k++ {
+		dest[k] = &buffer[k]
+	}
+	return &Rows{rows: rows, columns: columns, buffer: buffer, dest: dest, limit: s.limit}, nil
+}
+
+// Next advances to the next row, returning false when there are no more rows
+func (r *Rows) Next() bool {
+	if r.limit > 0 && r.count == r.limit {
+		return false
+	}
+	if !r.rows.Next() {
+		return false
+	}
+	r.count++
+	return true
+}
+
+// Columns returns the column names of the results
+func (r *Rows) Columns() []string {
+	return r.columns
+}
+
+// Scan copies the values of the current row into dest
+func (r *Rows) Scan(dest ...interface{}) error {
+	return r.rows.Scan(dest...)
+}
+
+// Values returns a copy of the values of the current row
+func (r *Rows) Values() ([]interface{}, error) {
+	if err := r.rows.Scan(r.dest...); err != nil {
+		return nil, err
+	}
+	row := make([]interface{}, len(r.buffer))
+	copy(row, r.buffer)
+	return row, nil
+}
+
+// Err returns the error, if any, encountered during iteration
+func (r *Rows) Err() error {
+	return r.rows.Err()
+}
+
+// Close releases the underlying rows
+func (r *Rows) Close() error {
+	return r.rows.Close()
 }
 
 // stream streams the query results to function fn
 func stream(db *sql.DB, fn StreamFunc, query string, args ...interface{}) error {
+	return streamN(db, fn, 0, query, args...)
+}
+
+// streamN streams up to limit rows of the query results to function fn (all rows if limit < 1)
+func streamN(db *sql.DB, fn StreamFunc, limit int, query string, args ...interface{}) error {
 	rows, err := db.Query(query, args...)
 	if err != nil {
 		return err
@@ -187,21 +695,52 @@ func stream(db *sql.DB, fn StreamFunc, query string, args ...interface{}) error
 		if err := fn(columns, i, buffer); err != nil {
 			return err
 		}
+		if i == limit {
+			break
+		}
 		i++
 	}
 	return err
 }
 
+// Flusher is implemented by writers that can send buffered data to
+// their destination, such as http.ResponseWriter
+type Flusher interface {
+	Flush()
+}
+
 // CSV streams the query results as a comma separated file
 func (s *Streamer) CSV(w io.Writer, header bool) error {
+	return s.CSVFlush(w, header, 0)
+}
+
+// CSVFlush streams the query results as a comma separated file,
+// flushing the output every n rows so slow queries reach the client
+// incrementally. If w is a Flusher it is flushed as well.
+//
+// A value of n <= 0 only flushes when the query is complete.
+func (s *Streamer) CSVFlush(w io.Writer, header bool, n int) error {
 	cw := csv.NewWriter(w)
+	flush := func() error {
+		cw.Flush()
+		if f, ok := w.(Flusher); ok {
+			f.Flush()
+		}
+		return cw.Error()
+	}
 	fn := func(columns []string, count int, buffer []interface{}) error {
 		if header && count == 1 {
 			cw.Write(columns)
 		}
-		return cw.Write(toString(buffer))
+		if err := cw.Write(toString(buffer)); err != nil {
+			return err
+		}
+		if n > 0 && count%n == 0 {
+			return flush()
+		}
+		return nil
 	}
-	defer cw.Flush()
+	defer flush()
 	return s.Stream(fn)
 }
 
@@ -242,6 +781,8 @@ func (s *Streamer) JSON(w io.Writer) error {
 				fmt.Fprint(w, v)
 			case []byte:
 				fmt.Fprintf(w, `"%v"`, string(v))
+			case time.Time:
+				fmt.Fprintf(w, `"%s"`, v.Format(TimeLayout))
 			default:
 				fmt.Fprintf(w, `"%v"`, v)
 			}
@@ -260,10 +801,14 @@ func RowMap(db *sql.DB, query string, args ...interface{}) (map[string]interface
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+	columns, err := Columns(rows)
+	if err != nil {
+		return nil, err
+	}
 	if !rows.Next() {
-		return nil, sql.ErrNoRows
+		return nil, noRows(rows)
 	}
-	columns, _ := Columns(rows)
 	buffer := make([]interface{}, len(columns))
 	dest := make([]interface{}, len(columns))
 	for k := 0; k < len(dest); k++ {
@@ -280,25 +825,146 @@ func RowMap(db *sql.DB, query string, args ...interface{}) (map[string]interface
 	return reply, nil
 }
 
+// RowMapTyped returns the results of a query as a map,
+// with values converted to the native Go type of each column
+// (e.g., int64, float64, string) rather than raw bytes
+//
+// Text stored in a numeric column is returned as a string
+func RowMapTyped(db *sql.DB, query string, args ...interface{}) (map[string]interface{}, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ctypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, noRows(rows)
+	}
+	buffer := make([]interface{}, len(ctypes))
+	dest := make([]interface{}, len(ctypes))
+	for k := 0; k < len(dest); k++ {
+		dest[k] = &buffer[k]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	reply := make(map[string]interface{})
+	for i, c := range ctypes {
+		v, err := typedVal(buffer[i], c.ScanType())
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.Name(), err)
+		}
+		reply[c.Name()] = v
+	}
+
+	return reply, nil
+}
+
+// scanKind returns the kind of value held by a scan type, looking through the sql.Null types
+func scanKind(typ reflect.Type) reflect.Kind {
+	switch typ {
+	case reflect.TypeOf(sql.NullInt64{}), reflect.TypeOf(sql.NullInt32{}),
+		reflect.TypeOf(sql.NullInt16{}), reflect.TypeOf(sql.NullByte{}):
+		return reflect.Int64
+	case reflect.TypeOf(sql.NullFloat64{}):
+		return reflect.Float64
+	case reflect.TypeOf(sql.NullString{}):
+		return reflect.String
+	case reflect.TypeOf(sql.NullBool{}):
+		return reflect.Bool
+	}
+	return typ.Kind()
+}
+
+// typedVal converts a scanned value to the kind of its column's scan type
+func typedVal(in interface{}, typ reflect.Type) (interface{}, error) {
+	if in == nil || typ == nil {
+		return in, nil
+	}
+	switch scanKind(typ) {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch v := in.(type) {
+		case int64:
+			return v, nil
+		case []byte, string:
+			// sqlite lets a numeric column hold any text
+			if i, err := strconv.ParseInt(strVal(v), 10, 64); err == nil {
+				return i, nil
+			}
+			return strVal(v), nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch v := in.(type) {
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		case []byte, string:
+			if f, err := strconv.ParseFloat(strVal(v), 64); err == nil {
+				return f, nil
+			}
+			return strVal(v), nil
+		}
+	case reflect.String:
+		switch v := in.(type) {
+		case []byte:
+			return string(v), nil
+		}
+	}
+	return in, nil
+}
+
+var errInserterDone = errors.New("insert transaction has ended")
+
 type inserted struct {
-	args []interface{}
-	err  chan error
+	args  []interface{}
+	flush bool
+	err   chan error
 }
 
 // Inserter enables inserting multiple records in a single transaction
 type Inserter struct {
-	c   chan inserted
-	err chan error
+	ctx  context.Context
+	c    chan inserted
+	err  chan error
+	done chan struct{}
+}
+
+// send delivers a request to the insert transaction and returns its reply
+func (i Inserter) send(in inserted) error {
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	in.err = make(chan error)
+	select {
+	case i.c <- in:
+		return <-in.err
+	case <-i.done:
+		if err := i.ctx.Err(); err != nil {
+			return err
+		}
+		return errInserterDone
+	}
 }
 
 // Insert inserts a record in a transaction
 func (i Inserter) Insert(args ...interface{}) error {
-	err := make(chan error)
-	i.c <- inserted{args, err}
-	return <-err
+	return i.send(inserted{args: args})
+}
+
+// Flush commits the records inserted so far and begins a new transaction
+func (i Inserter) Flush() error {
+	return i.send(inserted{flush: true})
 }
 
 // Close closes the insert transaction
+//
+// If the transaction was rolled back, the cause is returned
 func (i Inserter) Close() error {
 	close(i.c)
 	return <-i.err
@@ -306,28 +972,134 @@ func (i Inserter) Close() error {
 
 // NewInserter returns an Inserter that allows inserting  multiple records as a single transaction
 func NewInserter(db *sql.DB, query string) (*Inserter, error) {
+	return newInserter(context.Background(), db, query, 0)
+}
+
+// NewInserterContext returns an Inserter that rolls back its transaction when ctx is done
+func NewInserterContext(ctx context.Context, db *sql.DB, query string) (*Inserter, error) {
+	return newInserter(ctx, db, query, 0)
+}
+
+// NewBatchInserter returns an Inserter that commits every batchSize records,
+// bounding the size of each transaction during large imports
+func NewBatchInserter(db *sql.DB, query string, batchSize int) (*Inserter, error) {
+	if batchSize < 1 {
+		return nil, fmt.Errorf("invalid batch size: %d", batchSize)
+	}
+	return newInserter(context.Background(), db, query, batchSize)
+}
+
+// beginInsert starts a transaction with the insert query prepared
+func beginInsert(db *sql.DB, query string) (*sql.Tx, *sql.Stmt, error) {
 	tx, err := db.Begin()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	stmt, err := tx.Prepare(query)
 	if err != nil {
 		tx.Rollback()
+		return nil, nil, err
+	}
+	return tx, stmt, nil
+}
+
+// newInserter returns an Inserter that commits every batch records (if batch > 0)
+func newInserter(ctx context.Context, db *sql.DB, query string, batch int) (*Inserter, error) {
+	tx, stmt, err := beginInsert(db, query)
+	if err != nil {
 		return nil, err
 	}
 	c := make(chan inserted)
-	e := make(chan error)
-	inserter := Inserter{c, e}
+	e := make(chan error, 1)
+	done := make(chan struct{})
+	inserter := Inserter{ctx, c, e, done}
+	flush := func() error {
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		tx, stmt, err = beginInsert(db, query)
+		return err
+	}
+	// abort replies to the request (if any) and ends the transaction with err
+	abort := func(i *inserted, err error) {
+		if tx != nil {
+			tx.Rollback()
+		}
+		if i != nil {
+			i.err <- err
+		}
+		e <- err
+	}
 	go func() {
-		for i := range c {
-			if _, err = stmt.Exec(i.args...); err != nil {
-				tx.Rollback()
-				i.err <- err
+		defer close(done)
+		count := 0
+		for {
+			select {
+			case <-ctx.Done():
+				abort(nil, ctx.Err())
 				return
+			case i, ok := <-c:
+				if err := ctx.Err(); err != nil {
+					if !ok {
+						abort(nil, err)
+					} else {
+						abort(&i, err)
+					}
+					return
+				}
+				if !ok {
+					e <- tx.Commit()
+					return
+				}
+				if i.flush {
+					if err := flush(); err != nil {
+						abort(&i, err)
+						return
+					}
+					i.err <- nil
+					count = 0
+					continue
+				}
+				if _, err := stmt.Exec(i.args...); err != nil {
+					abort(&i, err)
+					return
+				}
+				count++
+				if batch > 0 && count >= batch {
+					if err := flush(); err != nil {
+						abort(&i, err)
+						return
+					}
+					count = 0
+				}
+				i.err <- nil
 			}
-			i.err <- nil
 		}
-		e <- tx.Commit()
 	}()
 	return &inserter, nil
 }
+
+// TypedInserter enables inserting multiple records of type T in a single transaction
+type TypedInserter[T any] struct {
+	inserter *Inserter
+	bind     func(T) []interface{}
+}
+
+// NewTypedInserter returns a TypedInserter that uses bind to convert each row to query args
+func NewTypedInserter[T any](db *sql.DB, query string, bind func(T) []interface{}) (*TypedInserter[T], error) {
+	inserter, err := NewInserter(db, query)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedInserter[T]{inserter: inserter, bind: bind}, nil
+}
+
+// Insert inserts a record in a transaction
+func (t *TypedInserter[T]) Insert(row T) error {
+	return t.inserter.Insert(t.bind(row)...)
+}
+
+// Close closes the insert transaction
+func (t *TypedInserter[T]) Close() error {
+	return t.inserter.Close()
+}
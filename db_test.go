@@ -1,10 +1,14 @@
 package dbutil
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -40,9 +44,6 @@ var (
 
 func init() {
 	os.Remove(testFile)
-	if testing.Verbose() {
-		testout = os.Stdout
-	}
 	sql.Register(testDriver, &sqlite3.SQLiteDriver{})
 }
 
@@ -64,6 +65,43 @@ func structDb(t *testing.T) *sql.DB {
 	return db
 }
 
+func TestQueryColumns(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	meta, err := QueryColumns(db, "select id, name as label, kind from structs where kind > ?", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []struct {
+		name, kind string
+		scan       reflect.Kind
+	}{
+		{"id", "INTEGER", reflect.Int64},
+		{"label", "TEXT", reflect.String},
+		{"kind", "INT", reflect.Int64},
+	}
+	if len(meta) != len(expect) {
+		t.Fatalf("expected %d columns but got: %d", len(expect), len(meta))
+	}
+	for i, m := range meta {
+		if m.Name != expect[i].name || m.DatabaseTypeName != expect[i].kind {
+			t.Errorf("expected column %s %s but got: %s %s", expect[i].name, expect[i].kind, m.Name, m.DatabaseTypeName)
+		}
+		if m.ScanType == nil || scanKind(m.ScanType) != expect[i].scan {
+			t.Errorf("column %s: expected scan type %s but got: %v", m.Name, expect[i].scan, m.ScanType)
+		}
+	}
+}
+
+func TestQueryColumnsBadQuery(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	if _, err := QueryColumns(db, queryBad); err == nil {
+		t.Fatal("expected query error")
+	}
+}
+
 func TestStream(t *testing.T) {
 	db := structDb(t)
 	defer db.Close()
@@ -109,6 +147,163 @@ func TestStreamBadFunc(t *testing.T) {
 	}
 }
 
+func TestStreamLimit(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	var seen int
+	myStream := func(columns []string, count int, buffer []interface{}) error {
+		seen = count
+		return nil
+	}
+	if err := NewStreamer(db, querySelect).Limit(2).Stream(myStream); err != nil {
+		t.Fatal(err)
+	}
+	if seen != 2 {
+		t.Errorf("expected 2 rows but got: %d", seen)
+	}
+
+	var buf bytes.Buffer
+	if err := NewStreamer(db, querySelect).Limit(3).CSV(&buf, true); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 4 {
+		t.Errorf("expected header and 3 rows but got %d lines", lines)
+	}
+}
+
+func TestStreamChan(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	data, errc := NewStreamer(db, "select name from structs order by id").Chan(context.Background())
+	var rows [][]interface{}
+	for row := range data {
+		rows = append(rows, row)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(testData) {
+		t.Fatalf("expected %d rows but got: %d", len(testData), len(rows))
+	}
+	for i, row := range rows {
+		if name := strVal(row[0]); name != testData[i][0] {
+			t.Errorf("row %d: expected %s but got: %s", i, testData[i][0], name)
+		}
+	}
+}
+
+func TestStreamChanCancel(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	data, errc := NewStreamer(db, querySelect).Chan(ctx)
+	<-data
+	cancel()
+	for range data {
+	}
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("expected context canceled error but got: %v", err)
+	}
+}
+
+func TestStreamReduce(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	sum := func(acc interface{}, columns []string, values []interface{}) (interface{}, error) {
+		kind, ok := values[2].(int64)
+		if !ok {
+			return nil, fmt.Errorf("expected numeric kind: %v", values[2])
+		}
+		return acc.(int64) + kind, nil
+	}
+	total, err := NewStreamer(db, querySelect).Reduce(int64(0), sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expect int64
+	if err := Row(db, []interface{}{&expect}, "select sum(kind) from structs"); err != nil {
+		t.Fatal(err)
+	}
+	if total != expect {
+		t.Errorf("expected sum %d but got: %v", expect, total)
+	}
+}
+
+func TestStreamReduceError(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	bad := func(acc interface{}, columns []string, values []interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("bad func, no biscuit")
+	}
+	if _, err := NewStreamer(db, querySelect).Reduce(0, bad); err == nil {
+		t.Fatal("expected reduce error")
+	}
+}
+
+func TestStreamIter(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	iter, err := NewStreamer(db, "select name, kind from structs where kind > ? order by id", 10).Iter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for iter.Next() {
+		values, err := iter.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, values[0].(string))
+		if len(names) == 2 {
+			break
+		}
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "abc,def" {
+		t.Errorf("unexpected names: %v", names)
+	}
+	if n := db.Stats().InUse; n != 1 {
+		t.Errorf("expected open rows to hold a connection but %d in use", n)
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.Stats().InUse; n != 0 {
+		t.Errorf("expected Close to release the connection but %d in use", n)
+	}
+}
+
+func TestStreamIterScanLimit(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	iter, err := NewStreamer(db, "select kind from structs order by id").Limit(3).Iter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iter.Close()
+
+	var total int
+	for iter.Next() {
+		var kind int
+		if err := iter.Scan(&kind); err != nil {
+			t.Fatal(err)
+		}
+		total += kind
+	}
+	if total != 23+69+42 {
+		t.Errorf("expected sum of first 3 kinds but got: %d", total)
+	}
+}
+
 func TestStreamCSV(t *testing.T) {
 	db := structDb(t)
 	defer db.Close()
@@ -121,6 +316,116 @@ func TestStreamCSV(t *testing.T) {
 	}
 }
 
+func TestStreamTimeLayout(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+
+	stamp := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	if _, err := db.Exec("insert into structs(name, modified) values(?,?)", "abc", stamp); err != nil {
+		t.Fatal(err)
+	}
+	const query = "select modified from structs"
+	emit := map[string]func(*Streamer, *bytes.Buffer) error{
+		"csv":   func(s *Streamer, b *bytes.Buffer) error { return s.CSV(b, false) },
+		"tsv":   func(s *Streamer, b *bytes.Buffer) error { return s.TSV(b, false) },
+		"json":  func(s *Streamer, b *bytes.Buffer) error { return s.JSON(b) },
+		"table": func(s *Streamer, b *bytes.Buffer) error { return s.Table(b, false, nil) },
+	}
+	check := func(want string) {
+		t.Helper()
+		for name, fn := range emit {
+			var buf bytes.Buffer
+			if err := fn(NewStreamer(db, query), &buf); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%s: expected %s in output: %s", name, want, buf.String())
+			}
+		}
+	}
+	check("2021-03-04T05:06:07Z")
+
+	defer func(layout string) { TimeLayout = layout }(TimeLayout)
+	TimeLayout = "02 Jan 2006"
+	check("04 Mar 2021")
+}
+
+type celsius float64
+
+func TestRegisterFormatter(t *testing.T) {
+	RegisterFormatter(reflect.TypeOf(celsius(0)), func(v interface{}) string {
+		return fmt.Sprintf("%.1f°C", v)
+	})
+	if got := strVal(celsius(21.5)); got != "21.5°C" {
+		t.Errorf("expected formatted value but got: %s", got)
+	}
+	RegisterFormatter(reflect.TypeOf(celsius(0)), nil)
+	if got := strVal(celsius(21.5)); got != "21.5" {
+		t.Errorf("expected default value after removal but got: %s", got)
+	}
+}
+
+func TestRegisterFormatterCSV(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	const query = "select name, modified from structs where name=?"
+	var buf bytes.Buffer
+	if err := NewStreamer(db, query, "abc").CSV(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "stamped") {
+		t.Fatalf("unexpected default output: %s", buf.String())
+	}
+
+	timeType := reflect.TypeOf(time.Time{})
+	RegisterFormatter(timeType, func(v interface{}) string {
+		return "stamped " + v.(time.Time).Format("Mon")
+	})
+	defer RegisterFormatter(timeType, nil)
+
+	buf.Reset()
+	if err := NewStreamer(db, query, "abc").CSV(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.HasPrefix(got, "abc,stamped ") || len(got) != len("abc,stamped Mon\n") {
+		t.Errorf("expected formatted timestamp but got: %q", got)
+	}
+}
+
+// flushRecorder records the bytes written as of each flush
+type flushRecorder struct {
+	bytes.Buffer
+	flushed []string
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushed = append(f.flushed, f.String())
+}
+
+func TestStreamCSVFlush(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	w := &flushRecorder{}
+	if err := NewStreamer(db, "select name from structs order by id").CSVFlush(w, false, 1); err != nil {
+		t.Fatal(err)
+	}
+	// one flush per row plus the final flush
+	if len(w.flushed) != len(testData)+1 {
+		t.Fatalf("expected %d flushes but got: %d", len(testData)+1, len(w.flushed))
+	}
+	if w.flushed[0] != "abc\n" {
+		t.Errorf("expected first flush to contain only the first row but got: %q", w.flushed[0])
+	}
+	last := testData[len(testData)-1][0].(string)
+	for _, f := range w.flushed[:len(testData)-1] {
+		if strings.Contains(f, last) {
+			t.Errorf("final row flushed early: %q", f)
+		}
+	}
+}
+
 func TestStreamTSV(t *testing.T) {
 	db := structDb(t)
 	defer db.Close()
@@ -429,14 +734,23 @@ func TestColumnsEmpty(t *testing.T) {
 	db := structDb(t)
 	defer db.Close()
 
-	const query = "select name, kind from structs where name='this name does not exist'"
+	const query = "select name, kind as type from structs where name='this name does not exist'"
 	rows, err := db.Query(query)
 	if err != nil {
 		t.Fatal("unexpected error:", err)
 	}
-	rows.Next()
+	columns, err := Columns(rows)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(columns) != 2 || columns[0] != "name" || columns[1] != "type" {
+		t.Errorf("unexpected columns: %v", columns)
+	}
+	if rows.Next() {
+		t.Fatal("expected no rows")
+	}
 	if _, err := Columns(rows); err == nil {
-		t.Fatal("expected empty row error")
+		t.Fatal("expected closed rows error")
 	}
 }
 
@@ -453,6 +767,177 @@ func TestRow(t *testing.T) {
 	t.Logf("kind = %d, name = %s\n", kind, name)
 }
 
+func TestScalar(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	name, err := Scalar[string](db, "select name from structs where kind=?", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "hij" {
+		t.Errorf("expected name hij but got: %s", name)
+	}
+	count, err := Scalar[int64](db, "select count(*) from structs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != int64(len(testData)) {
+		t.Errorf("expected count %d but got: %d", len(testData), count)
+	}
+	if _, err := Scalar[string](db, "select name from structs where kind=?", -1); err != sql.ErrNoRows {
+		t.Errorf("expected no rows error but got: %v", err)
+	}
+}
+
+func TestScalarContextCanceled(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ScalarContext[int64](ctx, db, "select count(*) from structs"); err != context.Canceled {
+		t.Fatalf("expected context canceled error but got: %v", err)
+	}
+}
+
+func TestColumn(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	names, err := Column[string](db, "select name from structs order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds, err := Column[int64](db, "select kind from structs order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	halves, err := Column[float64](db, "select kind / 2.0 from structs order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != len(testData) || len(kinds) != len(testData) || len(halves) != len(testData) {
+		t.Fatalf("expected %d values but got: %d, %d, %d", len(testData), len(names), len(kinds), len(halves))
+	}
+	for i, row := range testData {
+		if names[i] != row[0] || kinds[i] != int64(row[1].(int)) || halves[i] != float64(row[1].(int))/2 {
+			t.Errorf("row %d: unexpected values %s, %d, %f", i, names[i], kinds[i], halves[i])
+		}
+	}
+}
+
+func TestColumnMultiple(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	if _, err := Column[string](db, "select name, kind from structs"); err == nil {
+		t.Fatal("expected error for multiple columns")
+	}
+}
+
+func TestColumnBadType(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	if _, err := Column[int64](db, "select name from structs"); err == nil {
+		t.Fatal("expected scan error")
+	}
+}
+
+func TestExists(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	const query = "select * from structs where name=?"
+	found, err := Exists(db, query, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Error("expected matching row to exist")
+	}
+	if found, err = Exists(db, query+";", "this does not exist"); err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("expected no matching row")
+	}
+	if found, err = Exists(db, "select 1 from structs where name=? -- by name", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Error("expected matching row to exist for query ending in a comment")
+	}
+	if _, err := Exists(db, queryBad); err == nil {
+		t.Error("expected query error")
+	}
+}
+
+func TestGetBool(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	big, err := GetBool(db, "select kind > 40 from structs where name=?", "def")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !big {
+		t.Error("expected true")
+	}
+	if _, err := GetBool(db, "select kind > 40 from structs where name=?", "no such name"); err != sql.ErrNoRows {
+		t.Errorf("expected no rows error but got: %v", err)
+	}
+}
+
+func TestGetFloat64(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	avg, err := GetFloat64(db, "select avg(kind) from structs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avg != 34 {
+		t.Errorf("expected average of 34 but got: %f", avg)
+	}
+}
+
+func TestGetTime(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	tests := []struct {
+		query string
+		want  time.Time
+	}{
+		{"select '2020-07-24 12:34:56'", time.Date(2020, 7, 24, 12, 34, 56, 0, time.UTC)},
+		{"select '2020-07-24T12:34:56.5Z'", time.Date(2020, 7, 24, 12, 34, 56, 5e8, time.UTC)},
+		{"select '2020-07-24'", time.Date(2020, 7, 24, 0, 0, 0, 0, time.UTC)},
+		{"select 1595594096", time.Date(2020, 7, 24, 12, 34, 56, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := GetTime(db, tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: expected %v but got: %v", tt.query, tt.want, got)
+		}
+	}
+	modified, err := GetTime(db, "select modified from structs limit 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(modified) > time.Hour {
+		t.Errorf("expected recent modified time but got: %v", modified)
+	}
+	if _, err := GetTime(db, "select 'not a time'"); err == nil {
+		t.Error("expected error for invalid timestamp")
+	}
+	if _, err := GetTime(db, "select modified from structs where name=?", "no such name"); err != sql.ErrNoRows {
+		t.Errorf("expected no rows error but got: %v", err)
+	}
+}
+
 func TestRowEmpty(t *testing.T) {
 	db := structDb(t)
 	defer db.Close()
@@ -508,7 +993,78 @@ func TestRowMapEmpty(t *testing.T) {
 	}
 }
 
-func TestRowStrings(t *testing.T) {
+func TestRowMapTyped(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	query := "select id, name, kind, cast(kind as real) / 2 as half from structs where name=?"
+	row, err := RowMapTyped(db, query, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := row["id"].(int64); !ok {
+		t.Errorf("expected id to be int64 but got: %T", row["id"])
+	}
+	if name, ok := row["name"].(string); !ok || name != "abc" {
+		t.Errorf("expected name to be string 'abc' but got: %v (%T)", row["name"], row["name"])
+	}
+	if kind, ok := row["kind"].(int64); !ok || kind != 23 {
+		t.Errorf("expected kind to be int64 23 but got: %v (%T)", row["kind"], row["kind"])
+	}
+	if half, ok := row["half"].(float64); !ok || half != 11.5 {
+		t.Errorf("expected half to be float64 11.5 but got: %v (%T)", row["half"], row["half"])
+	}
+}
+
+func TestRowMapTypedText(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	if _, err := db.Exec("insert into structs(name, kind) values(?, ?)", "text", "n/a"); err != nil {
+		t.Fatal(err)
+	}
+	row, err := RowMapTyped(db, "select name, kind from structs where name=?", "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row["kind"] != "n/a" {
+		t.Errorf("expected text kind to be string 'n/a' but got: %v (%T)", row["kind"], row["kind"])
+	}
+}
+
+func TestTypedVal(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		typ  reflect.Type
+		want interface{}
+	}{
+		{nil, reflect.TypeOf(sql.NullInt64{}), nil},
+		{[]byte("42"), reflect.TypeOf(sql.NullInt64{}), int64(42)},
+		{[]byte("4.5"), reflect.TypeOf(float64(0)), 4.5},
+		{int64(4), reflect.TypeOf(sql.NullFloat64{}), float64(4)},
+		{[]byte("text"), reflect.TypeOf(sql.NullString{}), "text"},
+		{[]byte("n/a"), reflect.TypeOf(sql.NullInt64{}), "n/a"},
+		{"n/a", reflect.TypeOf(sql.NullFloat64{}), "n/a"},
+	}
+	for _, tt := range tests {
+		got, err := typedVal(tt.in, tt.typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("expected %v (%T) but got: %v (%T)", tt.want, tt.want, got, got)
+		}
+	}
+}
+
+func TestRowMapTypedEmpty(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	query := "select * from structs where name=?"
+	if _, err := RowMapTyped(db, query, "this does not exist"); err != sql.ErrNoRows {
+		t.Fatalf("expected no rows error but got: %v", err)
+	}
+}
+
+func TestRowStrings(t *testing.T) {
 	db := structDb(t)
 	defer db.Close()
 	query := "select * from structs where name=? and kind=?"
@@ -524,6 +1080,31 @@ func TestRowStrings(t *testing.T) {
 	}
 }
 
+func TestRowStringsNull(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	row, nulls, err := RowStringsNull(db, "select name, data, '' as empty, null as missing from structs where kind=?", 23)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"abc", "what ev er", "", ""}
+	mask := []bool{false, false, false, true}
+	for i := range expect {
+		if row[i] != expect[i] || nulls[i] != mask[i] {
+			t.Errorf("column %d: expected %q (null:%t) but got: %q (null:%t)", i, expect[i], mask[i], row[i], nulls[i])
+		}
+	}
+}
+
+func TestRowStringsNullEmpty(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	if _, _, err := RowStringsNull(db, "select * from structs where name='no such name'"); err != sql.ErrNoRows {
+		t.Fatalf("expected no rows error but got: %v", err)
+	}
+}
+
 func TestRowStringsEmpty(t *testing.T) {
 	db := structDb(t)
 	defer db.Close()
@@ -603,6 +1184,35 @@ func TestExecBadQuery(t *testing.T) {
 	}
 }
 
+func TestExec(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	const insert = "insert into structs(name, kind, data) values(?,?,?)"
+	affected, last, err := Exec(db, insert, "exec", 1, "inserted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected != 1 || last != int64(len(testData)+1) {
+		t.Errorf("insert: expected 1 affected and last id %d but got: %d, %d", len(testData)+1, affected, last)
+	}
+
+	const update = "update structs set data=? where kind > ?"
+	if affected, _, err = Exec(db, update, "updated", 40); err != nil {
+		t.Fatal(err)
+	}
+	if affected != 2 {
+		t.Errorf("update: expected 2 affected but got: %d", affected)
+	}
+
+	if affected, _, err = Exec(db, update, "updated", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if affected != 0 {
+		t.Errorf("no-op: expected 0 affected but got: %d", affected)
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	db := structDb(t)
 	defer db.Close()
@@ -690,6 +1300,29 @@ func TestInsertManyMissingArgs(t *testing.T) {
 	}
 }
 
+func TestInsertManyBadRow(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	kind := 314159
+	args := [][]interface{}{
+		{"many1", kind, "pie-hole"},
+		{"many2", kind, "pie-hole"},
+		{"many3", kind},
+	}
+	query := "insert into structs(name, kind, data) values(?,?,?)"
+	err := InsertMany(db, query, args...)
+	if err == nil {
+		t.Fatalf("expected error for missing args")
+	}
+	if !strings.HasPrefix(err.Error(), "row 2 [many3 314159]: ") {
+		t.Errorf("expected error to identify the failing row but got: %v", err)
+	}
+	if cnt := structCount(t, db); cnt != len(testData) {
+		t.Errorf("expected %d records after rollback but got: %d", len(testData), cnt)
+	}
+}
+
 func TestInsertManyBadQuery(t *testing.T) {
 	db := structDb(t)
 	defer db.Close()
@@ -701,6 +1334,271 @@ func TestInsertManyBadQuery(t *testing.T) {
 	}
 }
 
+func TestPlaceholders(t *testing.T) {
+	for n, want := range map[int]string{0: "", 1: "?", 3: "?,?,?"} {
+		if got := Placeholders(n); got != want {
+			t.Errorf("expected %q for %d but got: %q", want, n, got)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	tests := []struct {
+		query string
+		args  []interface{}
+		want  string
+	}{
+		{"select * from structs", nil, "select * from structs"},
+		{"select * from structs where name=? and kind=?", []interface{}{"m'kay", 69}, "select * from structs where name='m''kay' and kind=69"},
+		{"select '?' from structs where id=?", []interface{}{1}, "select '?' from structs where id=1"},
+		{"select * from structs where id in (?,?)", []interface{}{nil}, "select * from structs where id in (NULL,?)"},
+		{"select * -- isn't it?\nfrom structs where id=? and name=?", []interface{}{1, "abc"}, "select * -- isn't it?\nfrom structs where id=1 and name='abc'"},
+		{`select "a?b" /* don't ? */ from structs where id=?`, []interface{}{2}, `select "a?b" /* don't ? */ from structs where id=2`},
+	}
+	for _, tt := range tests {
+		if got := Interpolate(tt.query, tt.args); got != tt.want {
+			t.Errorf("expected: %s got: %s", tt.want, got)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		query string
+		args  []interface{}
+		want  string
+		flat  []interface{}
+	}{
+		{"select * from structs where id=?", []interface{}{1}, "select * from structs where id=?", []interface{}{1}},
+		{"select * from structs where id in (?)", []interface{}{[]int{1, 2, 3}}, "select * from structs where id in (?,?,?)", []interface{}{1, 2, 3}},
+		{"select * from structs where id in (?)", []interface{}{[]int{}}, "select * from structs where id in ()", []interface{}{}},
+		{"select * from structs where kind>? and name in (?) and data=?", []interface{}{2, []string{"a", "b"}, []byte("x")},
+			"select * from structs where kind>? and name in (?,?) and data=?", []interface{}{2, "a", "b", []byte("x")}},
+		{"select '?' from structs where id in (?)", []interface{}{[]int64{7}}, "select '?' from structs where id in (?)", []interface{}{int64(7)}},
+		{`select "a?b" from structs where id in (?)`, []interface{}{[]int{1, 2}}, `select "a?b" from structs where id in (?,?)`, []interface{}{1, 2}},
+		{"select id -- isn't it?\nfrom structs where id in (?) and kind=?", []interface{}{[]int{1, 2}, 3},
+			"select id -- isn't it?\nfrom structs where id in (?,?) and kind=?", []interface{}{1, 2, 3}},
+		{"select id /* don't ? */ from structs where id in (?)", []interface{}{[]int{4}}, "select id /* don't ? */ from structs where id in (?)", []interface{}{4}},
+	}
+	for _, tt := range tests {
+		query, args := Expand(tt.query, tt.args...)
+		if query != tt.want {
+			t.Errorf("expected: %s got: %s", tt.want, query)
+		}
+		if !reflect.DeepEqual(args, tt.flat) {
+			t.Errorf("expected args: %v got: %v", tt.flat, args)
+		}
+	}
+}
+
+func TestExpandQuery(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	query, args := Expand("select name from structs where kind > ? and name in (?) order by id", 10, []string{"abc", "hij", "klm"})
+	names, err := Column[string](db, query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "abc,hij" {
+		t.Errorf("unexpected names: %v", names)
+	}
+
+	query, args = Expand("select name from structs where name in (?)", []string{})
+	if names, err = Column[string](db, query, args...); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("expected no names for empty list but got: %v", names)
+	}
+
+	query, args = Expand("select name from structs where name not in (?)", []string{})
+	if names, err = Column[string](db, query, args...); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != len(testData) {
+		t.Errorf("expected all names for not in an empty list but got: %v", names)
+	}
+}
+
+func TestQuoteIdent(t *testing.T) {
+	tests := map[string]string{
+		"structs":       `"structs"`,
+		"my table":      `"my table"`,
+		`say "cheese"`:  `"say ""cheese"""`,
+		`x"; drop me--`: `"x""; drop me--"`,
+	}
+	for name, want := range tests {
+		if got := QuoteIdent(name); got != want {
+			t.Errorf("expected %s but got: %s", want, got)
+		}
+	}
+}
+
+func TestQuoteIdentQuery(t *testing.T) {
+	db := memDB(t)
+	defer db.Close()
+
+	const table, column = `odd "table" name`, `odd column`
+	query := fmt.Sprintf("create table %s (%s text)", QuoteIdent(table), QuoteIdent(column))
+	if _, err := db.Exec(query); err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]interface{}{{"a"}, {"b"}, {"b"}}
+	if err := ReplaceTableData(db, table, rows); err != nil {
+		t.Fatal(err)
+	}
+	count, err := CountDistinct(db, table, column, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 distinct values but got: %d", count)
+	}
+}
+
+func TestReplaceTableData(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	rows := [][]interface{}{
+		{nil, "new1", 1, "fresh", nil},
+		{nil, "new2", 2, "fresh", nil},
+	}
+	if err := ReplaceTableData(db, "structs", rows); err != nil {
+		t.Fatal(err)
+	}
+	var count, fresh int
+	if err := Row(db, []interface{}{&count}, "select count(*) from structs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Row(db, []interface{}{&fresh}, "select count(*) from structs where data='fresh'"); err != nil {
+		t.Fatal(err)
+	}
+	if count != len(rows) || fresh != len(rows) {
+		t.Errorf("expected only %d new rows but got %d rows (%d new)", len(rows), count, fresh)
+	}
+}
+
+func TestReplaceTableDataBadRow(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	rows := [][]interface{}{
+		{nil, "new1", 1, "fresh", nil},
+		{nil, "new2", 2},
+	}
+	if err := ReplaceTableData(db, "structs", rows); err == nil {
+		t.Fatal("expected error for short row")
+	}
+	var count int
+	if err := Row(db, []interface{}{&count}, "select count(*) from structs"); err != nil {
+		t.Fatal(err)
+	}
+	if count != len(testData) {
+		t.Errorf("expected original %d rows after rollback but got: %d", len(testData), count)
+	}
+}
+
+func TestCountDistinct(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	prepare(db)
+
+	count, err := CountDistinct(db, "structs", "kind", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != int64(len(testData)) {
+		t.Errorf("expected %d distinct kinds but got: %d", len(testData), count)
+	}
+	count, err = CountDistinct(db, "structs", "kind", "kind > ?", 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 distinct kinds but got: %d", count)
+	}
+}
+
+func TestCountDistinctBadTable(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	if _, err := CountDistinct(db, `structs"; drop table structs; --`, "kind", ""); err == nil {
+		t.Fatal("expected error for unknown table")
+	}
+	if _, err := CountDistinct(db, "structs", "kind", ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func structCount(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var cnt int
+	if err := Row(db, []interface{}{&cnt}, "select count(*) from structs"); err != nil {
+		t.Fatal(err)
+	}
+	return cnt
+}
+
+func TestWithTx(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	const query = "insert into structs(name, kind, data) values(?,?,?)"
+	err := WithTx(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(query, "tx", 1, "committed")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt := structCount(t, db); cnt != len(testData)+1 {
+		t.Errorf("expected %d records but got: %d", len(testData)+1, cnt)
+	}
+}
+
+func TestWithTxError(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	const query = "insert into structs(name, kind, data) values(?,?,?)"
+	bad := fmt.Errorf("bad func, no biscuit")
+	err := WithTx(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(query, "tx", 1, "rolled back"); err != nil {
+			return err
+		}
+		return bad
+	})
+	if err != bad {
+		t.Errorf("expected original error but got: %v", err)
+	}
+	if cnt := structCount(t, db); cnt != len(testData) {
+		t.Errorf("expected %d records after rollback but got: %d", len(testData), cnt)
+	}
+}
+
+func TestWithTxPanic(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	const query = "insert into structs(name, kind, data) values(?,?,?)"
+	func() {
+		defer func() {
+			if p := recover(); p == nil {
+				t.Error("expected panic to be re-raised")
+			}
+		}()
+		WithTx(db, func(tx *sql.Tx) error {
+			tx.Exec(query, "tx", 1, "rolled back")
+			panic("oops")
+		})
+	}()
+	if cnt := structCount(t, db); cnt != len(testData) {
+		t.Errorf("expected %d records after rollback but got: %d", len(testData), cnt)
+	}
+}
+
 func TestQueryClosed(t *testing.T) {
 	db, err := open(testFile)
 	if err != nil {
@@ -734,6 +1632,17 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestGetBadQuery(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	if _, _, err := Get(db, queryBad); err == nil {
+		t.Fatal("expected query error")
+	} else if err == sql.ErrNoRows {
+		t.Fatal("expected query error rather than no rows")
+	}
+}
+
 func TestGetEmpty(t *testing.T) {
 	db := structDb(t)
 	defer db.Close()
@@ -818,3 +1727,151 @@ func TestInserterMissingArgs(t *testing.T) {
 		t.Log("got expected error:", err)
 	}
 }
+
+func TestTypedInserter(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+
+	type record struct {
+		name string
+		kind int
+		data string
+	}
+	const q1 = "insert into structs(name, kind, data) values(?,?,?)"
+	insert, err := NewTypedInserter(db, q1, func(r record) []interface{} {
+		return []interface{}{r.name, r.kind, r.data}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range testData {
+		r := record{row[0].(string), row[1].(int), row[2].(string)}
+		if err := insert.Insert(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := insert.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var cnt int
+	if err := Row(db, []interface{}{&cnt}, "select count(*) as cnt from structs"); err != nil {
+		t.Fatal(err)
+	}
+	if cnt != len(testData) {
+		t.Errorf("expected count to be %d but got: %d", len(testData), cnt)
+	}
+}
+
+func TestTypedInserterBadQuery(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+	const q1 = "insert into tabledoesnotexist(name) values(?)"
+	_, err := NewTypedInserter(db, q1, func(s string) []interface{} {
+		return []interface{}{s}
+	})
+	if err == nil {
+		t.Fatal("expected error but got none")
+	}
+}
+
+func TestBatchInserter(t *testing.T) {
+	db, cleanup := fileDB(t)
+	defer cleanup()
+	if _, err := db.Exec(queryCreate); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func() int {
+		var cnt int
+		if err := Row(db, []interface{}{&cnt}, "select count(*) as cnt from structs"); err != nil {
+			t.Fatal(err)
+		}
+		return cnt
+	}
+
+	const q1 = "insert into structs(name, kind, data) values(?,?,?)"
+	insert, err := NewBatchInserter(db, q1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range testData[:3] {
+		if err := insert.Insert(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cnt := count(); cnt != 2 {
+		t.Errorf("expected first batch of 2 to be committed but got: %d", cnt)
+	}
+	if err := insert.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if cnt := count(); cnt != 3 {
+		t.Errorf("expected 3 records after flush but got: %d", cnt)
+	}
+	if err := insert.Insert(testData[3]...); err != nil {
+		t.Fatal(err)
+	}
+	if err := insert.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if cnt := count(); cnt != len(testData) {
+		t.Errorf("expected %d records after close but got: %d", len(testData), cnt)
+	}
+}
+
+func TestBatchInserterBadSize(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+	const q1 = "insert into structs(name, kind, data) values(?,?,?)"
+	if _, err := NewBatchInserter(db, q1, 0); err == nil {
+		t.Fatal("expected error for invalid batch size")
+	}
+}
+
+func TestInserterContext(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	const q1 = "insert into structs(name, kind, data) values(?,?,?)"
+	insert, err := NewInserterContext(ctx, db, q1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := insert.Insert(testData[0]...); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := insert.Insert(testData[1]...); err != context.Canceled {
+		t.Errorf("expected context canceled error but got: %v", err)
+	}
+	if err := insert.Close(); err != context.Canceled {
+		t.Errorf("expected close to report context canceled but got: %v", err)
+	}
+	var cnt int
+	if err := Row(db, []interface{}{&cnt}, "select count(*) as cnt from structs"); err != nil {
+		t.Fatal(err)
+	}
+	if cnt != 0 {
+		t.Errorf("expected rollback to leave no records but got: %d", cnt)
+	}
+}
+
+func TestInserterMissingArgsClose(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+	const q1 = "insert into structs(name, kind, data) values(?,?,?)"
+	insert, err := NewInserter(db, q1)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := insert.Insert("myname", 99); err == nil {
+		t.Fatal("expected error but got none")
+	}
+	if err := insert.Insert(testData[0]...); err == nil {
+		t.Error("expected error inserting after failure")
+	}
+	if err := insert.Close(); err == nil {
+		t.Error("expected close to report the failed insert")
+	}
+}
@@ -0,0 +1,140 @@
+package dbutil
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqliteTime is the layout used for timestamps in dumped SQL
+const sqliteTime = "2006-01-02 15:04:05.999999999-07:00"
+
+// sqlLiteral returns a value as an SQL literal
+func sqlLiteral(in interface{}) string {
+	switch v := in.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'"
+	case time.Time:
+		return "'" + v.Format(sqliteTime) + "'"
+	default:
+		return "'" + strings.Replace(strVal(v), "'", "''", -1) + "'"
+	}
+}
+
+// DumpTable writes the schema and contents of a table as SQL statements
+func DumpTable(db *sql.DB, w io.Writer, table string) error {
+	return dumpTable(db, w, table)
+}
+
+func dumpTable(q queryer, w io.Writer, table string) error {
+	var ddl string
+	const query = "select sql from sqlite_master where type='table' and name=?"
+	if err := q.QueryRow(query, table).Scan(&ddl); err == sql.ErrNoRows {
+		return fmt.Errorf("no such table: %s", table)
+	} else if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s;\n", ddl)
+	return dumpRows(q, w, table)
+}
+
+// dumpRows writes the rows of a table as INSERT statements
+//
+// As in the sqlite3 shell, sqlite renders each value with quote(), so
+// the value and its storage class survive being replayed.
+func dumpRows(q queryer, w io.Writer, table string) error {
+	columns, err := column[string](q, "select name from pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = "quote(" + QuoteIdent(col) + ")"
+	}
+	rows, err := q.Query("select " + strings.Join(quoted, ",") + " from " + QuoteIdent(table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]string, len(columns))
+	dest := make([]interface{}, len(columns))
+	for k := 0; k < len(values); k++ {
+		dest[k] = &values[k]
+	}
+	insert := "INSERT INTO " + QuoteIdent(table) + " VALUES("
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s%s);\n", insert, strings.Join(values, ",")); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// DumpAll writes the schema and contents of all user tables, followed by
+// their indexes, views and triggers, as a single SQL transaction
+//
+// The database is read in a single transaction, so the dump is a consistent
+// snapshot. AUTOINCREMENT counters in sqlite_sequence are included.
+func DumpAll(db *sql.DB, w io.Writer) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	// nothing is written, so there is nothing to commit
+	defer tx.Rollback()
+
+	tables, err := tables(tx)
+	if err != nil {
+		return err
+	}
+	const query = `select sql from sqlite_master where type in ('index', 'view', 'trigger') and sql is not null and name not like 'sqlite_%'`
+	others, err := column[string](tx, query)
+	if err != nil {
+		return err
+	}
+	sequence, err := column[string](tx, "select name from sqlite_master where type='table' and name='sqlite_sequence'")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "PRAGMA foreign_keys=OFF;")
+	fmt.Fprintln(w, "BEGIN TRANSACTION;")
+	for _, table := range tables {
+		if err := dumpTable(tx, w, table); err != nil {
+			return err
+		}
+	}
+	if len(sequence) > 0 {
+		// sqlite creates the table along with the first AUTOINCREMENT table
+		fmt.Fprintln(w, "DELETE FROM sqlite_sequence;")
+		if err := dumpRows(tx, w, "sqlite_sequence"); err != nil {
+			return err
+		}
+	}
+	for _, ddl := range others {
+		fmt.Fprintf(w, "%s;\n", ddl)
+	}
+	_, err = fmt.Fprintln(w, "COMMIT;")
+	return err
+}
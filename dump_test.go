@@ -0,0 +1,174 @@
+package dbutil
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSQLLiteral(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{nil, "NULL"},
+		{int64(42), "42"},
+		{3.5, "3.5"},
+		{"m'kay", "'m''kay'"},
+		{[]byte{0xde, 0xad}, "X'dead'"},
+	}
+	for _, tt := range tests {
+		if got := sqlLiteral(tt.in); got != tt.want {
+			t.Errorf("expected %s but got: %s", tt.want, got)
+		}
+	}
+}
+
+func TestDumpTable(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	if err := DumpTable(db, &buf, "structs"); err != nil {
+		t.Fatal(err)
+	}
+	dump := buf.String()
+	t.Log(dump)
+	if !strings.HasPrefix(dump, "CREATE TABLE structs") {
+		t.Errorf("expected dump to begin with table DDL: %s", dump)
+	}
+	if n := strings.Count(dump, "INSERT INTO"); n != len(testData) {
+		t.Errorf("expected %d inserts but got: %d", len(testData), n)
+	}
+}
+
+func TestDumpTableMissing(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	if err := DumpTable(db, testout, "nosuchtable"); err == nil {
+		t.Fatal("expected error for missing table")
+	}
+}
+
+func TestDumpAll(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	if _, err := db.Exec("create index structs_kind on structs(kind)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := DumpAll(db, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// replay the dump into an empty database
+	copied := memDB(t)
+	defer copied.Close()
+	if _, err := copied.Exec(buf.String()); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range testData {
+		var data string
+		if err := Row(copied, []interface{}{&data}, "select data from structs where name=? and kind=?", row[0], row[1]); err != nil {
+			t.Fatal(err)
+		}
+		if data != row[2] {
+			t.Errorf("expected data %q but got: %q", row[2], data)
+		}
+	}
+	indexes, err := Indexes(copied, "structs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 1 {
+		t.Errorf("expected index to be restored but got: %v", indexes)
+	}
+}
+
+func TestDumpAllRestore(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	const schema = `create table logs (id integer primary key autoincrement, msg text);
+create index structs_kind on structs(kind);
+create view kinds as select kind, count(*) as total from structs group by kind;
+CREATE TRIGGER log_insert AFTER INSERT ON structs BEGIN insert into logs(msg) values('added; ' || NEW.name); END;
+insert into structs(name, kind, data) values('nop', 7, 'a; b; c');
+delete from logs where msg like '%nop';
+create table vals (v, d DATETIME);
+insert into vals values(2.0, '2020-01-02 03:04:05');
+insert into vals values(9e999, 1577934245);
+insert into vals values(-9e999, x'00ff');`
+	statements, err := SplitStatements(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statements {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := DumpAll(db, &buf); err != nil {
+		t.Fatal(err)
+	}
+	dump := buf.String()
+	t.Log(dump)
+
+	restored := memDB(t)
+	defer restored.Close()
+	restored.SetMaxOpenConns(1)
+	if statements, err = SplitStatements(dump); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statements {
+		if _, err := restored.Exec(s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+
+	// values keep their storage class and text
+	const query = "select group_concat(typeof(v) || ':' || cast(v as text) || ',' || typeof(d) || ':' || cast(d as text), ';') from vals"
+	want, err := Scalar[string](db, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Scalar[string](restored, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("expected restored values: %s\ngot: %s", want, got)
+	}
+	if !strings.Contains(want, "real:2.0,text:2020-01-02 03:04:05;real:Inf,integer:1577934245") {
+		t.Errorf("unexpected original values: %s", want)
+	}
+
+	buf.Reset()
+	if err := DumpAll(restored, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != dump {
+		t.Errorf("expected restored dump to match original:\n%s", buf.String())
+	}
+
+	// the counter must survive even though the last log row was deleted
+	id, err := Insert(restored, "insert into logs(msg) values(?)", "next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 2 {
+		t.Errorf("expected autoincrement id 2 but got: %d", id)
+	}
+	if _, err := restored.Exec("insert into structs(name) values('qrs')"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := Exists(restored, "select 1 from logs where msg = ?", "added; qrs"); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Error("expected restored trigger to log the insert")
+	}
+}
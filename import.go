@@ -0,0 +1,171 @@
+package dbutil
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ImportJSON inserts a JSON array of objects, or a stream of newline
+// delimited objects, into a table and returns the count of records inserted
+//
+// Object keys are mapped to table columns regardless of case, a missing
+// key inserts the column's default (or NULL) and a key that is not a
+// column of the table is an error, as is a record that is not an object.
+// Nested objects and arrays are stored as their JSON text.
+// All records are inserted in a single transaction.
+func ImportJSON(db *sql.DB, table string, r io.Reader) (int64, error) {
+	return importJSON(db, table, r, false)
+}
+
+// ImportJSONLenient is ImportJSON but ignores keys that are not columns of the table
+func ImportJSONLenient(db *sql.DB, table string, r io.Reader) (int64, error) {
+	return importJSON(db, table, r, true)
+}
+
+func importJSON(db *sql.DB, table string, r io.Reader, lenient bool) (int64, error) {
+	info, err := TableInfo(db, table)
+	if err != nil {
+		return 0, err
+	}
+	columns := make([]string, len(info))
+	index := make(map[string]int)
+	for i, c := range info {
+		columns[i] = QuoteIdent(c.Name)
+		// sqlite column names are case insensitive
+		index[strings.ToLower(c.Name)] = i
+	}
+
+	br := bufio.NewReader(r)
+	array, err := isArray(br)
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+	if array {
+		// consume the opening bracket
+		if _, err := dec.Token(); err != nil {
+			return 0, err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	// a statement for each set of keys seen, as keys may vary by record
+	stmts := make(map[string]*sql.Stmt)
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+	fail := func(err error) (int64, error) {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var count int64
+	for !array || dec.More() {
+		var obj map[string]interface{}
+		if err := dec.Decode(&obj); err == io.EOF && !array {
+			break
+		} else if err != nil {
+			return fail(fmt.Errorf("record %d: %w", count+1, err))
+		}
+		if obj == nil {
+			return fail(fmt.Errorf("record %d: not a JSON object", count+1))
+		}
+		// values by column position, with absent keys left out so that
+		// the column defaults apply
+		values := make([]interface{}, len(columns))
+		present := make([]bool, len(columns))
+		for k, v := range obj {
+			i, ok := index[strings.ToLower(k)]
+			if !ok {
+				if lenient {
+					continue
+				}
+				return fail(fmt.Errorf("record %d: no column %q in table %s", count+1, k, table))
+			}
+			if values[i], err = jsonVal(v); err != nil {
+				return fail(fmt.Errorf("record %d: %w", count+1, err))
+			}
+			present[i] = true
+		}
+		var names []string
+		var args []interface{}
+		for i, ok := range present {
+			if ok {
+				names = append(names, columns[i])
+				args = append(args, values[i])
+			}
+		}
+		key := strings.Join(names, ",")
+		stmt, ok := stmts[key]
+		if !ok {
+			query := fmt.Sprintf("insert into %s (%s) values(%s)", QuoteIdent(table), key, Placeholders(len(names)))
+			if len(names) == 0 {
+				query = fmt.Sprintf("insert into %s default values", QuoteIdent(table))
+			}
+			if stmt, err = tx.Prepare(query); err != nil {
+				return fail(err)
+			}
+			stmts[key] = stmt
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return fail(fmt.Errorf("record %d: %w", count+1, err))
+		}
+		count++
+	}
+	if array {
+		if tok, err := dec.Token(); err != nil || tok != json.Delim(']') {
+			return fail(fmt.Errorf("unterminated JSON array after %d records", count))
+		}
+	}
+	return count, tx.Commit()
+}
+
+// isArray reports whether the next non-space character is the start of a JSON array
+func isArray(br *bufio.Reader) (bool, error) {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return false, err
+		}
+		if !unicode.IsSpace(rune(b[0])) {
+			return b[0] == '[', nil
+		}
+		br.ReadByte()
+	}
+}
+
+// jsonVal converts a decoded JSON value to a value suitable for a query arg
+func jsonVal(in interface{}) (interface{}, error) {
+	switch v := in.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		if f, err := v.Float64(); err == nil {
+			return f, nil
+		}
+		return v.String(), nil
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,199 @@
+package dbutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportJSON(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+
+	const data = `[
+	{"name": "abc", "kind": 23, "data": "what ev er"},
+	{"name": "def", "kind": 69},
+	{"name": "hij", "kind": 4.2, "data": "meaning of life"}
+]`
+	count, err := ImportJSON(db, "structs", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 records but got: %d", count)
+	}
+	row, err := RowMap(db, "select kind, data from structs where name=?", "def")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row["kind"] != int64(69) {
+		t.Errorf("expected kind 69 but got: %v (%T)", row["kind"], row["kind"])
+	}
+	if row["data"] != nil {
+		t.Errorf("expected missing data to be NULL but got: %v", row["data"])
+	}
+}
+
+func TestImportNDJSON(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+
+	const data = `{"name": "abc", "kind": 23}
+{"name": "def", "kind": 69}
+`
+	count, err := ImportJSON(db, "structs", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 records but got: %d", count)
+	}
+}
+
+func TestImportJSONExtraKey(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+
+	const data = `[{"name": "abc", "kind": 23, "color": "red"}]`
+	if _, err := ImportJSON(db, "structs", strings.NewReader(data)); err == nil {
+		t.Fatal("expected error for unknown column")
+	} else {
+		t.Log(err)
+	}
+	count, err := ImportJSONLenient(db, "structs", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 record but got: %d", count)
+	}
+}
+
+func TestImportJSONBad(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+
+	const data = `[{"name": "abc"}, {"name": ]`
+	if _, err := ImportJSON(db, "structs", strings.NewReader(data)); err == nil {
+		t.Fatal("expected error for invalid json")
+	}
+	var cnt int
+	if err := Row(db, []interface{}{&cnt}, "select count(*) from structs"); err != nil {
+		t.Fatal(err)
+	}
+	if cnt != 0 {
+		t.Errorf("expected rollback to leave no records but got: %d", cnt)
+	}
+}
+
+func TestImportJSONNested(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+
+	const data = `[
+	{"name": "abc", "kind": 1, "data": {"color": "red", "size": 10}},
+	{"name": "def", "kind": 2, "data": [1, 2.5, "three"]},
+	{"name": "hij", "kind": 3, "data": "plain"}
+]`
+	count, err := ImportJSON(db, "structs", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 records but got: %d", count)
+	}
+	expect := map[string]string{
+		"abc": `{"color":"red","size":10}`,
+		"def": `[1,2.5,"three"]`,
+		"hij": "plain",
+	}
+	for name, want := range expect {
+		got, err := Scalar[string](db, "select data from structs where name=?", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %s but got: %s", name, want, got)
+		}
+	}
+}
+
+func TestImportJSONDefaults(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+	if _, err := db.Exec("create table colors (id integer primary key, name text, shade text default 'plain')"); err != nil {
+		t.Fatal(err)
+	}
+
+	const data = `[{"name": "red"}, {"name": "blue", "shade": "navy"}, {"name": "green", "shade": null}, {}]`
+	count, err := ImportJSON(db, "colors", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("expected 4 records but got: %d", count)
+	}
+	got, err := Scalar[string](db, "select group_concat(coalesce(name, '-') || ':' || coalesce(shade, 'NULL'), ',') from colors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "red:plain,blue:navy,green:NULL,-:plain"
+	if got != want {
+		t.Errorf("expected %s but got: %s", want, got)
+	}
+}
+
+func TestImportJSONTruncated(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+
+	const data = `[{"name": "abc"}, {"name": "def"}`
+	if _, err := ImportJSON(db, "structs", strings.NewReader(data)); err == nil {
+		t.Fatal("expected error for unterminated array")
+	} else {
+		t.Log(err)
+	}
+	if n, err := Scalar[int](db, "select count(*) from structs"); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Errorf("expected rollback to leave no records but got: %d", n)
+	}
+}
+
+func TestImportJSONNotObject(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+
+	for _, data := range []string{
+		`[null, {"name": "abc"}]`,
+		`[{"name": "abc"}, 42]`,
+		"{\"name\": \"abc\"}\nnull\n",
+	} {
+		if _, err := ImportJSON(db, "structs", strings.NewReader(data)); err == nil {
+			t.Errorf("expected error for %s", data)
+		} else {
+			t.Log(err)
+		}
+	}
+	if n, err := Scalar[int](db, "select count(*) from structs"); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Errorf("expected rollback to leave no records but got: %d", n)
+	}
+}
+
+func TestImportJSONKeyCase(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+
+	const data = `[{"Name": "abc", "KIND": 23}]`
+	if _, err := ImportJSON(db, "structs", strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	kind, err := Scalar[int](db, "select kind from structs where name=?", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind != 23 {
+		t.Errorf("expected kind 23 but got: %d", kind)
+	}
+}
@@ -0,0 +1,374 @@
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Vacuum rebuilds the database file, reclaiming unused space
+func Vacuum(db *sql.DB) error {
+	_, err := db.Exec("VACUUM")
+	return err
+}
+
+// VacuumInto writes a compacted copy of the database to dest,
+// leaving the live database untouched
+func VacuumInto(db *sql.DB, dest string) error {
+	_, err := db.Exec("VACUUM INTO ?", dest)
+	return err
+}
+
+// BackupTo writes a backup copy of the database to w, e.g. for upload
+// to object storage. The copy is made in a temporary file, which is
+// removed once it has been written to w.
+func BackupTo(db *sql.DB, w io.Writer) error {
+	dir, err := ioutil.TempDir("", "dbutil")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	dest := filepath.Join(dir, "backup.db")
+	if err := VacuumInto(db, dest); err != nil {
+		return err
+	}
+	f, err := os.Open(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// IncrementalVacuum frees up to pages unused pages from a database in
+// auto_vacuum=incremental mode (all of them if pages < 1)
+func IncrementalVacuum(db *sql.DB, pages int) error {
+	query := "PRAGMA incremental_vacuum"
+	if pages > 0 {
+		query = fmt.Sprintf("PRAGMA incremental_vacuum(%d)", pages)
+	}
+	// a page is freed for each step of the query, so read every row
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// Checkpoint runs a WAL checkpoint in the given mode (PASSIVE, FULL, RESTART or TRUNCATE)
+// and returns whether it was blocked, the number of frames in the log,
+// and the number of frames checkpointed
+func Checkpoint(db *sql.DB, mode string) (busy, log, checkpointed int64, err error) {
+	switch mode = strings.ToUpper(mode); mode {
+	case "PASSIVE", "FULL", "RESTART", "TRUNCATE":
+	default:
+		return 0, 0, 0, fmt.Errorf("invalid checkpoint mode: %q", mode)
+	}
+	query := fmt.Sprintf("PRAGMA wal_checkpoint(%s)", mode)
+	err = db.QueryRow(query).Scan(&busy, &log, &checkpointed)
+	return busy, log, checkpointed, err
+}
+
+// Optimize runs sqlite's query planner analysis on tables that may benefit from it
+func Optimize(db *sql.DB) error {
+	_, err := db.Exec("PRAGMA optimize")
+	return err
+}
+
+// Ping verifies the database is reachable, for use as a health check.
+// If deep is true it also runs a quick integrity check of the database.
+func Ping(ctx context.Context, db *sql.DB, deep bool) error {
+	if err := db.PingContext(ctx); err != nil {
+		return err
+	}
+	if !deep {
+		return nil
+	}
+	result, err := ScalarContext[string](ctx, db, "PRAGMA quick_check")
+	if err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("quick check failed: %s", result)
+	}
+	return nil
+}
+
+// IntegrityCheck checks the database for corruption and returns the problems
+// found, or a single "ok" if there are none. If quick is true it runs the
+// faster quick_check, which skips verifying that indexes match their tables.
+func IntegrityCheck(db *sql.DB, quick bool) ([]string, error) {
+	if quick {
+		return Column[string](db, "PRAGMA quick_check")
+	}
+	return Column[string](db, "PRAGMA integrity_check")
+}
+
+var pragmaName = regexp.MustCompile(`^[A-Za-z_]+$`)
+
+// pragma returns the first value reported by the named pragma
+func pragma(db *sql.DB, name string) (interface{}, error) {
+	if !pragmaName.MatchString(name) {
+		return nil, fmt.Errorf("invalid pragma name: %q", name)
+	}
+	var value interface{}
+	if err := db.QueryRow("PRAGMA " + name).Scan(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Pragma returns the value of the named pragma as a string
+func Pragma(db *sql.DB, name string) (string, error) {
+	value, err := pragma(db, name)
+	return strVal(value), err
+}
+
+// PragmaInt returns the value of the named pragma as an integer
+func PragmaInt(db *sql.DB, name string) (int64, error) {
+	value, err := pragma(db, name)
+	if err != nil {
+		return 0, err
+	}
+	if i, ok := value.(int64); ok {
+		return i, nil
+	}
+	return strconv.ParseInt(strVal(value), 10, 64)
+}
+
+// PragmaBool returns the value of the named pragma as a boolean
+func PragmaBool(db *sql.DB, name string) (bool, error) {
+	value, err := pragma(db, name)
+	if err != nil {
+		return false, err
+	}
+	if i, ok := value.(int64); ok {
+		return i != 0, nil
+	}
+	switch s := strings.ToLower(strVal(value)); s {
+	case "1", "on", "yes", "true":
+		return true, nil
+	case "0", "off", "no", "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("pragma %s is not a boolean: %q", name, s)
+	}
+}
+
+// JournalMode returns the journal mode of the database
+func JournalMode(db *sql.DB) (string, error) {
+	return Pragma(db, "journal_mode")
+}
+
+// ForeignKeys reports whether foreign key constraints are enforced
+func ForeignKeys(db *sql.DB) (bool, error) {
+	return PragmaBool(db, "foreign_keys")
+}
+
+// PlanNode is a step in a query plan
+type PlanNode struct {
+	Detail   string
+	Children []*PlanNode
+}
+
+// QueryPlan returns the query plan as a tree
+//
+// The root node has no detail, its children are the top level steps of the plan
+func QueryPlan(db *sql.DB, query string, args ...interface{}) (*PlanNode, error) {
+	rows, err := db.Query("EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	root := &PlanNode{}
+	nodes := map[int64]*PlanNode{0: root}
+	for rows.Next() {
+		var id, parent, notused int64
+		var detail string
+		if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+			return nil, err
+		}
+		node := &PlanNode{Detail: detail}
+		nodes[id] = node
+		up, ok := nodes[parent]
+		if !ok {
+			up = root
+		}
+		up.Children = append(up.Children, node)
+	}
+	return root, rows.Err()
+}
+
+// ExplainPlan returns the query plan as lines of text, indented to show nesting
+func ExplainPlan(db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	plan, err := QueryPlan(db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	var walk func(nodes []*PlanNode, depth int)
+	walk = func(nodes []*PlanNode, depth int) {
+		for _, node := range nodes {
+			lines = append(lines, strings.Repeat("  ", depth)+node.Detail)
+			walk(node.Children, depth+1)
+		}
+	}
+	walk(plan.Children, 0)
+	return lines, nil
+}
+
+var (
+	pragmaValue = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+	// pragmas that report state but cannot be set
+	readOnlyPragmas = map[string]bool{
+		"collation_list":   true,
+		"compile_options":  true,
+		"data_version":     true,
+		"database_list":    true,
+		"freelist_count":   true,
+		"function_list":    true,
+		"module_list":      true,
+		"page_count":       true,
+		"pragma_list":      true,
+		"integrity_check":  true,
+		"quick_check":      true,
+		"foreign_key_list": true,
+		"index_info":       true,
+		"index_list":       true,
+		"table_info":       true,
+	}
+
+	// pragmas that accept names but report numbers
+	pragmaEnums = map[string]map[string]string{
+		"synchronous": {"off": "0", "normal": "1", "full": "2", "extra": "3"},
+		"temp_store":  {"default": "0", "file": "1", "memory": "2"},
+		"auto_vacuum": {"none": "0", "full": "1", "incremental": "2"},
+	}
+)
+
+// pragmaNormal returns a canonical form of a pragma value for comparison
+func pragmaNormal(name string, value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	}
+	s := strings.ToLower(strVal(value))
+	if enum, ok := pragmaEnums[name]; ok {
+		if n, ok := enum[s]; ok {
+			return n
+		}
+	}
+	switch s {
+	case "on", "yes", "true":
+		return "1"
+	case "off", "no", "false":
+		return "0"
+	}
+	return s
+}
+
+// SetPragma sets the named pragma and confirms the new value took effect
+//
+// Pragmas that are per connection (e.g., foreign_keys) only apply to
+// the pooled connection used to set them
+func SetPragma(db *sql.DB, name string, value interface{}) error {
+	if !pragmaName.MatchString(name) {
+		return fmt.Errorf("invalid pragma name: %q", name)
+	}
+	name = strings.ToLower(name)
+	if readOnlyPragmas[name] {
+		return fmt.Errorf("pragma %s is read-only", name)
+	}
+	want := pragmaNormal(name, value)
+	if !pragmaValue.MatchString(want) {
+		return fmt.Errorf("invalid value for pragma %s: %v", name, value)
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("PRAGMA %s=%s", name, want)); err != nil {
+		return err
+	}
+	var got interface{}
+	if err := conn.QueryRowContext(ctx, "PRAGMA "+name).Scan(&got); err != nil {
+		return err
+	}
+	if have := pragmaNormal(name, got); have != want {
+		return fmt.Errorf("pragma %s is %s after setting it to %v", name, have, value)
+	}
+	return nil
+}
+
+// ColumnInfo describes a table column
+type ColumnInfo struct {
+	Name       string
+	Type       string
+	NotNull    bool
+	PrimaryKey bool
+	Default    sql.NullString
+}
+
+// Tables returns the names of the user tables in the database
+func Tables(db *sql.DB) ([]string, error) {
+	return tables(db)
+}
+
+func tables(q queryer) ([]string, error) {
+	const query = `select name from sqlite_master where type='table' and name not like 'sqlite_%' order by name`
+	return column[string](q, query)
+}
+
+// TableInfo returns the column definitions of a table
+func TableInfo(db *sql.DB, table string) ([]ColumnInfo, error) {
+	const query = `select name, type, "notnull", pk, dflt_value from pragma_table_info(?) order by cid`
+	rows, err := db.Query(query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []ColumnInfo
+	for rows.Next() {
+		var c ColumnInfo
+		var pk int
+		if err := rows.Scan(&c.Name, &c.Type, &c.NotNull, &pk, &c.Default); err != nil {
+			return nil, err
+		}
+		c.PrimaryKey = pk > 0
+		columns = append(columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no such table: %s", table)
+	}
+	return columns, nil
+}
+
+// Indexes returns the names of the indexes on a table
+func Indexes(db *sql.DB, table string) ([]string, error) {
+	return Column[string](db, `select name from pragma_index_list(?) order by name`, table)
+}
@@ -0,0 +1,504 @@
+package dbutil
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func pageCount(t *testing.T, db *sql.DB) int64 {
+	t.Helper()
+	var count int64
+	if err := Row(db, []interface{}{&count}, "PRAGMA page_count"); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestVacuum(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+	fillAndEmpty(t, db)
+
+	before := pageCount(t, db)
+	if err := Vacuum(db); err != nil {
+		t.Fatal(err)
+	}
+	if after := pageCount(t, db); after >= before {
+		t.Errorf("expected page count to drop from %d but got: %d", before, after)
+	}
+}
+
+func TestVacuumClosed(t *testing.T) {
+	db := emptyTable(t)
+	db.Close()
+	if err := Vacuum(db); err == nil {
+		t.Fatal("expected error for closed db")
+	}
+}
+
+// fillAndEmpty inserts many records into the structs table and then deletes them
+func fillAndEmpty(t *testing.T, db *sql.DB) {
+	t.Helper()
+	const query = "insert into structs(name, kind, data) values(?,?,?)"
+	args := make([][]interface{}, 1000)
+	for i := range args {
+		args[i] = []interface{}{"vacuum", i, strings.Repeat("filler", 100)}
+	}
+	if err := InsertMany(db, query, args...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Update(db, "delete from structs"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVacuumInto(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+	fillAndEmpty(t, db)
+
+	dir, err := ioutil.TempDir("", "dbutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "copy.db")
+	if err := VacuumInto(db, dest); err != nil {
+		t.Fatal(err)
+	}
+	copied, err := open(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer copied.Close()
+	if after, before := pageCount(t, copied), pageCount(t, db); after >= before {
+		t.Errorf("expected copy to have fewer than %d pages but got: %d", before, after)
+	}
+	if _, err := TableInfo(copied, "structs"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBackupTo(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	if err := BackupTo(db, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("SQLite format 3\x00")) {
+		t.Fatalf("expected sqlite file header but got: %q", buf.Bytes()[:16])
+	}
+
+	dir, err := ioutil.TempDir("", "dbutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "restored.db")
+	if err := ioutil.WriteFile(dest, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := open(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	names, err := Column[string](restored, "select name from structs order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != len(testData) || names[0] != testData[0][0] {
+		t.Errorf("expected backup to hold the test data but got: %v", names)
+	}
+}
+
+func TestIncrementalVacuum(t *testing.T) {
+	db := memDB(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("PRAGMA auto_vacuum=INCREMENTAL"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(queryCreate); err != nil {
+		t.Fatal(err)
+	}
+	fillAndEmpty(t, db)
+	before, err := PragmaInt(db, "freelist_count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := IncrementalVacuum(db, 10); err != nil {
+		t.Fatal(err)
+	}
+	after, err := PragmaInt(db, "freelist_count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before-10 {
+		t.Errorf("expected freelist to drop from %d to %d but got: %d", before, before-10, after)
+	}
+	if err := IncrementalVacuum(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ = PragmaInt(db, "freelist_count"); after != 0 {
+		t.Errorf("expected empty freelist but got: %d", after)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	db, cleanup := fileDB(t)
+	defer cleanup()
+
+	if err := SetPragma(db, "journal_mode", "WAL"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(queryCreate); err != nil {
+		t.Fatal(err)
+	}
+	prepare(db)
+	busy, log, done, err := Checkpoint(db, "full")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if busy != 0 || log == 0 || done != log {
+		t.Errorf("unexpected checkpoint results busy:%d log:%d checkpointed:%d", busy, log, done)
+	}
+	if _, log, _, err = Checkpoint(db, "TRUNCATE"); err != nil {
+		t.Fatal(err)
+	}
+	if log != 0 {
+		t.Errorf("expected truncated log but got %d frames", log)
+	}
+}
+
+func TestCheckpointBadMode(t *testing.T) {
+	db := memDB(t)
+	defer db.Close()
+	if _, _, _, err := Checkpoint(db, "PASSIVE); drop table structs; --"); err == nil {
+		t.Fatal("expected error for invalid mode")
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	if err := Optimize(db); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := Ping(ctx, db, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := Ping(ctx, db, true); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := Ping(ctx, db, true); err != context.Canceled {
+		t.Errorf("expected context canceled but got: %v", err)
+	}
+}
+
+func TestIntegrityCheck(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	for _, quick := range []bool{true, false} {
+		result, err := IntegrityCheck(db, quick)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result) != 1 || result[0] != "ok" {
+			t.Errorf("quick=%t: expected ok but got: %v", quick, result)
+		}
+	}
+}
+
+func TestPragmaInt(t *testing.T) {
+	db := memDB(t)
+	defer db.Close()
+	size, err := PragmaInt(db, "page_size")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size <= 0 {
+		t.Errorf("expected positive page size but got: %d", size)
+	}
+}
+
+func TestPragmaBool(t *testing.T) {
+	db := memDB(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("PRAGMA foreign_keys=ON"); err != nil {
+		t.Fatal(err)
+	}
+	on, err := ForeignKeys(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !on {
+		t.Error("expected foreign keys to be enabled")
+	}
+	if _, err := PragmaBool(db, "journal_mode"); err == nil {
+		t.Error("expected error for non-boolean pragma")
+	}
+}
+
+func TestPragmaBadName(t *testing.T) {
+	db := memDB(t)
+	defer db.Close()
+	if _, err := Pragma(db, "page_size; drop table structs"); err == nil {
+		t.Fatal("expected error for invalid pragma name")
+	}
+}
+
+func TestJournalMode(t *testing.T) {
+	db := memDB(t)
+	defer db.Close()
+	mode, err := JournalMode(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != "memory" {
+		t.Errorf("expected memory journal mode but got: %s", mode)
+	}
+}
+
+func TestQueryPlan(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	const query = `select a.name from structs a where a.kind in (select b.kind from structs b where b.name=?)`
+	plan, err := QueryPlan(db, query, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nested bool
+	for _, node := range plan.Children {
+		t.Log(node.Detail)
+		for _, child := range node.Children {
+			t.Log("  ", child.Detail)
+			nested = true
+		}
+	}
+	if len(plan.Children) == 0 {
+		t.Fatal("expected plan steps")
+	}
+	if !nested {
+		t.Error("expected subquery to be nested under its parent step")
+	}
+}
+
+func TestQueryPlanJoin(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	const query = `select a.name, b.total from structs a
+join (select kind, count(*) as total from structs group by kind) b on a.kind = b.kind
+where a.name=?`
+	plan, err := QueryPlan(db, query, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parent *PlanNode
+	var joined bool
+	for _, node := range plan.Children {
+		t.Log(node.Detail)
+		for _, child := range node.Children {
+			t.Log("  ", child.Detail)
+		}
+		switch {
+		case strings.HasSuffix(node.Detail, " b") && len(node.Children) > 0:
+			parent = node
+		case strings.Contains(node.Detail, " a"):
+			joined = true
+		}
+	}
+	if parent == nil {
+		t.Fatal("expected the joined subquery to have its own steps")
+	}
+	if !strings.Contains(parent.Children[0].Detail, "structs") {
+		t.Errorf("expected the subquery to scan structs but got: %s", parent.Children[0].Detail)
+	}
+	if !joined {
+		t.Error("expected a top level step for the outer table of the join")
+	}
+}
+
+func TestExplainPlan(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	plan, err := ExplainPlan(db, "select * from structs where kind=?", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) == 0 || !strings.Contains(plan[0], "SCAN") {
+		t.Errorf("expected a table scan on an unindexed column but got: %v", plan)
+	}
+	if _, err := db.Exec("create index structs_kind on structs(kind)"); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = ExplainPlan(db, "select * from structs where kind=?", 42); err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) == 0 || !strings.Contains(plan[0], "structs_kind") {
+		t.Errorf("expected the index to be used but got: %v", plan)
+	}
+}
+
+func TestQueryPlanBadQuery(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	if _, err := QueryPlan(db, queryBad); err == nil {
+		t.Fatal("expected query error")
+	}
+}
+
+// fileDB returns a db in a temp directory and a func to remove it
+func fileDB(t *testing.T) (*sql.DB, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "dbutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := open(filepath.Join(dir, "test.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSetPragma(t *testing.T) {
+	db, cleanup := fileDB(t)
+	defer cleanup()
+
+	if err := SetPragma(db, "journal_mode", "WAL"); err != nil {
+		t.Fatal(err)
+	}
+	mode, err := Pragma(db, "journal_mode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Errorf("expected wal journal mode but got: %s", mode)
+	}
+	if err := SetPragma(db, "synchronous", "NORMAL"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetPragmaReadOnly(t *testing.T) {
+	db := memDB(t)
+	defer db.Close()
+	if err := SetPragma(db, "page_count", 1); err == nil {
+		t.Fatal("expected error for read-only pragma")
+	} else {
+		t.Log(err)
+	}
+}
+
+func TestSetPragmaMismatch(t *testing.T) {
+	db := memDB(t)
+	defer db.Close()
+	// in-memory databases cannot use WAL
+	if err := SetPragma(db, "journal_mode", "wal"); err == nil {
+		t.Fatal("expected error for mismatched pragma")
+	} else {
+		t.Log(err)
+	}
+}
+
+func TestTables(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	if _, err := db.Exec("create table other (id integer primary key)"); err != nil {
+		t.Fatal(err)
+	}
+	tables, err := Tables(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(tables, ",") != "other,structs" {
+		t.Errorf("unexpected tables: %v", tables)
+	}
+}
+
+func TestTableInfo(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	columns, err := TableInfo(db, "structs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []struct{ name, kind string }{
+		{"id", "INTEGER"},
+		{"name", "TEXT"},
+		{"kind", "INT"},
+		{"data", "BLOB"},
+		{"modified", "DATETIME"},
+	}
+	if len(columns) != len(expect) {
+		t.Fatalf("expected %d columns but got: %d", len(expect), len(columns))
+	}
+	for i, c := range columns {
+		if c.Name != expect[i].name || c.Type != expect[i].kind {
+			t.Errorf("expected column %s %s but got: %s %s", expect[i].name, expect[i].kind, c.Name, c.Type)
+		}
+		if c.PrimaryKey != (c.Name == "id") {
+			t.Errorf("column %s has wrong primary key flag: %t", c.Name, c.PrimaryKey)
+		}
+	}
+	if !columns[0].NotNull {
+		t.Error("expected id to be not null")
+	}
+	if columns[4].Default.String != "CURRENT_TIMESTAMP" {
+		t.Errorf("unexpected default for modified: %v", columns[4].Default)
+	}
+}
+
+func TestTableInfoMissing(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	if _, err := TableInfo(db, "nosuchtable"); err == nil {
+		t.Fatal("expected error for missing table")
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+	if _, err := db.Exec("create index structs_kind on structs(kind)"); err != nil {
+		t.Fatal(err)
+	}
+	indexes, err := Indexes(db, "structs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 1 || indexes[0] != "structs_kind" {
+		t.Errorf("unexpected indexes: %v", indexes)
+	}
+}
@@ -0,0 +1,71 @@
+package dbutil
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+const migrationsCreate = `create table if not exists schema_migrations (
+    version integer not null primary key,
+    applied DATETIME DEFAULT CURRENT_TIMESTAMP
+);`
+
+// Migration is a versioned schema change
+type Migration struct {
+	Version int
+	Up      string
+}
+
+// Migrate applies the migrations that have not yet been applied, in version order
+//
+// Each migration runs in its own transaction and is recorded in the
+// schema_migrations table, so running Migrate again is harmless.
+// A failing migration is rolled back and stops the run, leaving
+// earlier migrations applied.
+func Migrate(db *sql.DB, migrations []Migration) error {
+	if _, err := db.Exec(migrationsCreate); err != nil {
+		return err
+	}
+	pending := make([]Migration, len(migrations))
+	copy(pending, migrations)
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Version < pending[j].Version
+	})
+	for i, m := range pending {
+		if i > 0 && m.Version == pending[i-1].Version {
+			return fmt.Errorf("duplicate migration version: %d", m.Version)
+		}
+	}
+	for _, m := range pending {
+		if err := migrate(db, m); err != nil {
+			return fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+	}
+	return nil
+}
+
+// migrate applies a single migration if it has not been applied
+func migrate(db *sql.DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	var count int
+	if err := tx.QueryRow("select count(*) from schema_migrations where version=?", m.Version).Scan(&count); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count > 0 {
+		return tx.Rollback()
+	}
+	if _, err := tx.Exec(m.Up); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("insert into schema_migrations(version) values(?)", m.Version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
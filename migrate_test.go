@@ -0,0 +1,62 @@
+package dbutil
+
+import (
+	"database/sql"
+	"testing"
+)
+
+var testMigrations = []Migration{
+	{Version: 2, Up: "alter table structs add column extra text"},
+	{Version: 1, Up: queryCreate},
+}
+
+func migrations(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var count int
+	if err := Row(db, []interface{}{&count}, "select count(*) from schema_migrations"); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestMigrate(t *testing.T) {
+	db := memDB(t)
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := Migrate(db, testMigrations); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count := migrations(t, db); count != len(testMigrations) {
+		t.Errorf("expected %d migrations but got: %d", len(testMigrations), count)
+	}
+	if _, err := Insert(db, "insert into structs(name, extra) values(?,?)", "migrated", "more"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateFailure(t *testing.T) {
+	db := memDB(t)
+	defer db.Close()
+
+	bad := append(append([]Migration{}, testMigrations...), Migration{Version: 3, Up: queryBad})
+	if err := Migrate(db, bad); err == nil {
+		t.Fatal("expected migration error")
+	} else {
+		t.Log(err)
+	}
+	if count := migrations(t, db); count != len(testMigrations) {
+		t.Errorf("expected %d migrations but got: %d", len(testMigrations), count)
+	}
+}
+
+func TestMigrateDuplicate(t *testing.T) {
+	db := memDB(t)
+	defer db.Close()
+
+	dupe := []Migration{{1, queryCreate}, {1, queryCreate}}
+	if err := Migrate(db, dupe); err == nil {
+		t.Fatal("expected duplicate version error")
+	}
+}
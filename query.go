@@ -0,0 +1,100 @@
+package dbutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Clause builds the where, order by and limit clauses of a query,
+// keeping values as args rather than interpolating them into the SQL.
+//
+// Conditions are SQL written by the caller, with ? placeholders for
+// values; never build them from untrusted input. Column names passed
+// to OrderBy are quoted; check Err before running the query.
+type Clause struct {
+	where []string
+	order []string
+	args  []interface{}
+	limit int
+	err   error
+}
+
+// Where returns a Clause with the condition and its args
+func Where(cond string, args ...interface{}) *Clause {
+	return new(Clause).And(cond, args...)
+}
+
+// And adds a condition and its args, joined to prior conditions with AND
+func (c *Clause) And(cond string, args ...interface{}) *Clause {
+	c.where = append(c.where, "("+cond+")")
+	c.args = append(c.args, args...)
+	return c
+}
+
+// OrderBy adds columns to sort by, each optionally followed by ASC or DESC.
+// A column may be qualified by its table, e.g. "t.name DESC".
+//
+// An invalid direction or extra words are reported by Err.
+func (c *Clause) OrderBy(columns ...string) *Clause {
+	for _, col := range columns {
+		fields := strings.Fields(col)
+		if len(fields) == 0 || len(fields) > 2 {
+			c.setErr(fmt.Errorf("invalid order by column: %q", col))
+			continue
+		}
+		parts := strings.Split(fields[0], ".")
+		for i, part := range parts {
+			parts[i] = QuoteIdent(part)
+		}
+		order := strings.Join(parts, ".")
+		if len(fields) > 1 {
+			switch dir := strings.ToUpper(fields[1]); dir {
+			case "ASC", "DESC":
+				order += " " + dir
+			default:
+				c.setErr(fmt.Errorf("invalid order by direction: %q", fields[1]))
+				continue
+			}
+		}
+		c.order = append(c.order, order)
+	}
+	return c
+}
+
+// setErr records the first error in building the clause
+func (c *Clause) setErr(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// Err returns the first error in building the clause, if any
+func (c *Clause) Err() error {
+	return c.err
+}
+
+// Limit limits the number of rows returned (no limit if n < 1)
+func (c *Clause) Limit(n int) *Clause {
+	c.limit = n
+	return c
+}
+
+// String returns the clauses to append to a query
+func (c *Clause) String() string {
+	var b strings.Builder
+	if len(c.where) > 0 {
+		b.WriteString(" where " + strings.Join(c.where, " and "))
+	}
+	if len(c.order) > 0 {
+		b.WriteString(" order by " + strings.Join(c.order, ", "))
+	}
+	if c.limit > 0 {
+		fmt.Fprintf(&b, " limit %d", c.limit)
+	}
+	return b.String()
+}
+
+// Args returns the args for the placeholders in the clauses
+func (c *Clause) Args() []interface{} {
+	return c.args
+}
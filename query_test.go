@@ -0,0 +1,69 @@
+package dbutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClause(t *testing.T) {
+	c := Where("kind > ?", 10).And("name <> ?", "m'kay").OrderBy("kind desc", "name").Limit(2)
+	const want = ` where (kind > ?) and (name <> ?) order by "kind" DESC, "name" limit 2`
+	if got := c.String(); got != want {
+		t.Errorf("expected: %s\ngot: %s", want, got)
+	}
+	if len(c.Args()) != 2 {
+		t.Errorf("expected 2 args but got: %v", c.Args())
+	}
+	if got := new(Clause).String(); got != "" {
+		t.Errorf("expected empty clause but got: %s", got)
+	}
+}
+
+func TestClauseQuery(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	c := Where("name = ?", "x' or '1'='1").OrderBy("kind")
+	names, err := Column[string](db, "select name from structs"+c.String(), c.Args()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("expected bound arg to match nothing but got: %v", names)
+	}
+
+	c = Where("kind > ?", 10).OrderBy("kind desc").Limit(2)
+	if names, err = Column[string](db, "select name from structs"+c.String(), c.Args()...); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "def,hij" {
+		t.Errorf("unexpected names: %v", names)
+	}
+}
+
+func TestClauseOrderBy(t *testing.T) {
+	c := Where("s.kind > ?", 1).OrderBy("s.kind DESC", "name")
+	const want = ` where (s.kind > ?) order by "s"."kind" DESC, "name"`
+	if got := c.String(); got != want {
+		t.Errorf("expected: %s\ngot: %s", want, got)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	db := structDb(t)
+	defer db.Close()
+	names, err := Column[string](db, "select name from structs s"+c.String(), c.Args()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "def,hij,abc,klm" {
+		t.Errorf("unexpected names: %v", names)
+	}
+
+	for _, bad := range []string{"kind dsc", "kind desc nulls", " "} {
+		if err := new(Clause).OrderBy("id", bad).Err(); err == nil {
+			t.Errorf("expected error for order by %q", bad)
+		}
+	}
+}
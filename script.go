@@ -0,0 +1,199 @@
+package dbutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenPunct tokenKind = iota
+	tokenWord
+	tokenSpace
+	tokenQuoted
+	tokenComment
+)
+
+// token is a piece of SQL text; open is true for a quote or comment missing its end
+type token struct {
+	kind tokenKind
+	text string
+	open bool
+}
+
+// sqlScanner splits SQL text into tokens, so that quoted strings and
+// names, and comments, can be told apart from the SQL around them
+type sqlScanner struct {
+	src string
+	pos int
+}
+
+// at returns the byte n bytes ahead of the scanner, or 0 past the end
+func (s *sqlScanner) at(n int) byte {
+	if s.pos+n < len(s.src) {
+		return s.src[s.pos+n]
+	}
+	return 0
+}
+
+// skipLine advances the scanner to the end of the current line
+func (s *sqlScanner) skipLine() {
+	if i := strings.IndexByte(s.src[s.pos:], '\n'); i >= 0 {
+		s.pos += i
+	} else {
+		s.pos = len(s.src)
+	}
+}
+
+// next returns the next token, or false at the end of the text
+func (s *sqlScanner) next() (token, bool) {
+	if s.pos >= len(s.src) {
+		return token{}, false
+	}
+	start := s.pos
+	tok := token{kind: tokenPunct}
+	switch c := s.src[s.pos]; {
+	case c == '-' && s.at(1) == '-':
+		tok.kind = tokenComment
+		s.skipLine()
+	case c == '/' && s.at(1) == '*':
+		tok.kind = tokenComment
+		if i := strings.Index(s.src[s.pos+2:], "*/"); i >= 0 {
+			s.pos += i + 4
+		} else {
+			s.pos = len(s.src)
+			tok.open = true
+		}
+	case c == '\'' || c == '"' || c == '`' || c == '[':
+		tok.kind = tokenQuoted
+		tok.open = true
+		end := c
+		if c == '[' {
+			end = ']'
+		}
+		for s.pos++; s.pos < len(s.src); s.pos++ {
+			if s.src[s.pos] != end {
+				continue
+			}
+			// a doubled quote is an escaped quote
+			if end != ']' && s.at(1) == end {
+				s.pos++
+				continue
+			}
+			s.pos++
+			tok.open = false
+			break
+		}
+	case isSpace(c):
+		tok.kind = tokenSpace
+		for s.pos < len(s.src) && isSpace(s.src[s.pos]) {
+			s.pos++
+		}
+	case isWord(c):
+		tok.kind = tokenWord
+		for s.pos < len(s.src) && isWord(s.src[s.pos]) {
+			s.pos++
+		}
+	default:
+		s.pos++
+	}
+	tok.text = s.src[start:s.pos]
+	return tok, true
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isWord(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// SplitStatements splits an SQL script into individual statements
+//
+// Comments and dot commands (e.g., .read, .print) are dropped.
+// Semicolons within quotes or comments do not end a statement,
+// and a CREATE TRIGGER statement is returned whole, through its closing END.
+func SplitStatements(buffer string) ([]string, error) {
+	var statements []string
+	var stmt strings.Builder
+	var words []string // leading keywords of the statement
+	var last token
+	trigger := false
+	depth := 0 // BEGIN and CASE blocks open in a trigger
+
+	s := &sqlScanner{src: buffer}
+	for {
+		if strings.TrimSpace(stmt.String()) == "" && s.at(0) == '.' {
+			s.skipLine()
+			continue
+		}
+		tok, ok := s.next()
+		if !ok {
+			break
+		}
+		last = tok
+		switch tok.kind {
+		case tokenComment:
+			// keep the tokens on either side of a block comment apart
+			if strings.HasPrefix(tok.text, "/*") {
+				stmt.WriteByte(' ')
+			}
+			continue
+		case tokenWord:
+			word := strings.ToUpper(tok.text)
+			if len(words) < 3 {
+				words = append(words, word)
+				trigger = isTrigger(words)
+			}
+			if !trigger {
+				break
+			}
+			switch word {
+			case "BEGIN", "CASE":
+				depth++
+			case "END":
+				if depth > 0 {
+					depth--
+				}
+			}
+		case tokenPunct:
+			if tok.text != ";" || (trigger && depth > 0) {
+				break
+			}
+			stmt.WriteString(tok.text)
+			statements = append(statements, strings.TrimSpace(stmt.String()))
+			stmt.Reset()
+			words = words[:0]
+			trigger = false
+			continue
+		}
+		stmt.WriteString(tok.text)
+	}
+	text := strings.TrimSpace(stmt.String())
+	if text == "" {
+		return statements, nil
+	}
+	first := strings.SplitN(text, "\n", 2)[0]
+	switch {
+	case last.kind == tokenQuoted && last.open:
+		return nil, fmt.Errorf("unterminated quote: %s", first)
+	case trigger:
+		return nil, fmt.Errorf("unterminated trigger: %s", first)
+	}
+	return append(statements, text), nil
+}
+
+// isTrigger reports whether the leading keywords of a statement are
+// those of CREATE [TEMP|TEMPORARY] TRIGGER
+func isTrigger(words []string) bool {
+	if len(words) < 2 || words[0] != "CREATE" {
+		return false
+	}
+	if words[1] == "TEMP" || words[1] == "TEMPORARY" {
+		return len(words) > 2 && words[2] == "TRIGGER"
+	}
+	return words[1] == "TRIGGER"
+}
@@ -0,0 +1,187 @@
+package dbutil
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		file  string
+		count int
+	}{
+		{"sql/test.sql", 8},
+		{"sql/test2.sql", 7},
+		{"sql/test3.sql", 0},
+		{"sql/test4.sql", 1},
+	}
+	for _, tt := range tests {
+		buffer, err := ioutil.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statements, err := SplitStatements(string(buffer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(statements) != tt.count {
+			t.Errorf("%s: expected %d statements but got: %d", tt.file, tt.count, len(statements))
+		}
+		for _, s := range statements {
+			t.Log(s)
+		}
+	}
+}
+
+func TestSplitStatementsTrigger(t *testing.T) {
+	const script = `
+CREATE TRIGGER audit AFTER DELETE ON structs
+BEGIN
+    insert into gone values(OLD.id);
+    insert into gone values(OLD.id + 1000);
+END;
+insert into structs(name) values('abc');
+`
+	statements, err := SplitStatements(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 2 {
+		t.Fatalf("expected 2 statements but got: %d", len(statements))
+	}
+	if !strings.HasSuffix(statements[0], "END;") {
+		t.Errorf("expected trigger to end with END; but got: %s", statements[0])
+	}
+}
+
+func TestSplitStatementsUnterminated(t *testing.T) {
+	const script = `CREATE TRIGGER audit AFTER DELETE ON structs
+BEGIN
+    insert into gone values(OLD.id);
+`
+	if _, err := SplitStatements(script); err == nil {
+		t.Fatal("expected error for unterminated trigger")
+	}
+}
+
+func TestSplitStatementsQuoted(t *testing.T) {
+	const script = `
+insert into structs(name, data) values('a; b; c', "x;y"); -- trailing; comment
+/* block; comment
+   spanning lines; */
+insert into structs(name, data) values('it''s; fine', 'd');
+select [odd;name] from structs;
+`
+	statements, err := SplitStatements(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		`insert into structs(name, data) values('a; b; c', "x;y");`,
+		`insert into structs(name, data) values('it''s; fine', 'd');`,
+		`select [odd;name] from structs;`,
+	}
+	if len(statements) != len(expect) {
+		t.Fatalf("expected %d statements but got: %q", len(expect), statements)
+	}
+	for i, s := range statements {
+		if s != expect[i] {
+			t.Errorf("expected: %s\ngot: %s", expect[i], s)
+		}
+	}
+}
+
+func TestSplitStatementsExec(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+
+	statements, err := SplitStatements(`insert into structs(name) values('a; b; c');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statements {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	name, err := Scalar[string](db, "select name from structs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "a; b; c" {
+		t.Errorf("expected quoted semicolons to be kept but got: %s", name)
+	}
+}
+
+func TestSplitStatementsUnterminatedQuote(t *testing.T) {
+	if _, err := SplitStatements(`insert into structs(name) values('a; b`); err == nil {
+		t.Fatal("expected error for unterminated quote")
+	}
+}
+
+func TestSplitStatementsTriggerForms(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		count  int
+	}{
+		{"single line", `CREATE TRIGGER t AFTER INSERT ON x BEGIN insert into y values(NEW.id); END; select 1;`, 2},
+		{"temp", `CREATE TEMP TRIGGER t AFTER INSERT ON x
+BEGIN
+    insert into y values(NEW.id);
+    delete from z;
+END;`, 1},
+		{"temporary if not exists", `create temporary trigger if not exists t after insert on x
+begin
+    insert into y values(new.id);
+end;
+select 1;`, 2},
+		{"case end", `CREATE TRIGGER t AFTER INSERT ON x
+BEGIN
+    insert into y values(CASE WHEN NEW.id > 1 THEN 'big' ELSE 'small'
+    END);
+    insert into y values(CASE NEW.id WHEN 1 THEN 'one' END);
+END;
+select 1;`, 2},
+	}
+	for _, tt := range tests {
+		statements, err := SplitStatements(tt.script)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(statements) != tt.count {
+			t.Fatalf("%s: expected %d statements but got: %q", tt.name, tt.count, statements)
+		}
+		if !strings.HasSuffix(strings.ToUpper(statements[0]), "END;") {
+			t.Errorf("%s: expected trigger to end with END; but got: %s", tt.name, statements[0])
+		}
+	}
+}
+
+func TestSplitStatementsTriggerExec(t *testing.T) {
+	db := emptyTable(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1) // the temp trigger is per connection
+
+	const script = `create table gone (id integer, size text);
+CREATE TEMP TRIGGER audit AFTER DELETE ON structs BEGIN insert into gone values(OLD.id, CASE WHEN OLD.kind > 10 THEN 'big' ELSE 'small' END); END;
+insert into structs(name, kind) values('abc', 23);
+delete from structs;`
+	statements, err := SplitStatements(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statements {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+	size, err := Scalar[string](db, "select size from gone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != "big" {
+		t.Errorf("expected trigger to record big but got: %s", size)
+	}
+}
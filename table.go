@@ -5,6 +5,7 @@ import (
 	"io"
 	"strings"
 	"text/tabwriter"
+	"time"
 )
 
 const (
@@ -58,9 +59,15 @@ func tabular(w io.Writer, header bool, config *TableConfig) (*tabwriter.Writer,
 			if i > 0 {
 				fmt.Fprint(tw, "\t")
 			}
+			if fn, ok := formatter(v); ok {
+				fmt.Fprint(tw, fn(v))
+				continue
+			}
 			switch v := v.(type) {
 			case []uint8:
 				fmt.Fprint(tw, string(v))
+			case time.Time:
+				fmt.Fprint(tw, v.Format(TimeLayout))
 			default:
 				fmt.Fprint(tw, v)
 			}
@@ -71,10 +78,11 @@ func tabular(w io.Writer, header bool, config *TableConfig) (*tabwriter.Writer,
 	return tw, func(columns []string, row int, values []interface{}) error {
 		if header && row == 1 {
 			fmt.Fprintln(tw, strings.Join(columns, "\t"))
+			underline := make([]string, len(columns))
 			for i, col := range columns {
-				columns[i] = strings.Repeat("=", len(col))
+				underline[i] = strings.Repeat("=", len(col))
 			}
-			fmt.Fprintln(tw, strings.Join(columns, "\t"))
+			fmt.Fprintln(tw, strings.Join(underline, "\t"))
 		}
 		rower(values...)
 		return nil
@@ -1,7 +1,9 @@
 package dbutil
 
 import (
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -27,3 +29,28 @@ func TestTableError(t *testing.T) {
 		t.Log(err)
 	}
 }
+
+func TestTableColumnsIntact(t *testing.T) {
+	db := structDb(t)
+	defer db.Close()
+
+	// capture the columns after the table has written its header
+	var columns []string
+	tw, table := tabular(ioutil.Discard, true, nil)
+	fn := func(cols []string, row int, values []interface{}) error {
+		if err := table(cols, row, values); err != nil {
+			return err
+		}
+		if row == 1 {
+			columns = append([]string{}, cols...)
+		}
+		return nil
+	}
+	if err := NewStreamer(db, querySelect).Stream(fn); err != nil {
+		t.Fatal(err)
+	}
+	tw.Flush()
+	if strings.Join(columns, ",") != "id,name,kind,data,modified" {
+		t.Errorf("expected column names to be intact but got: %v", columns)
+	}
+}